@@ -0,0 +1,470 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type aggFunc int
+
+const (
+	aggNone aggFunc = iota
+	aggCount
+	aggSum
+	aggAvg
+	aggMin
+	aggMax
+)
+
+var (
+	aggQueryRep = regexp.MustCompile(`(?is)^\s*SELECT\s+(.+?)\s+FROM\s+(.+?)(?:\s+WHERE\s+(.+?))?(?:\s+GROUP\s+BY\s+(.+?))?(?:\s+LIMIT\s+(\d+))?\s*;?\s*$`)
+	aggFuncRep  = regexp.MustCompile(`(?is)^(COUNT|SUM|AVG|MIN|MAX)\s*\(\s*(.+?)\s*\)$`)
+	aggAliasRep = regexp.MustCompile(`(?is)^(.+?)\s+AS\s+(\w+|"[^"]+")$`)
+	// aggPathRep is a path such as s.status or s."user-agent", which S3 Select names after its last name.
+	aggPathRep = regexp.MustCompile(`^(?:(?:\w+|"[^"]+")\.)*(\w+|"[^"]+")$`)
+)
+
+type aggItem struct {
+	fn    aggFunc
+	expr  string
+	alias string
+	// cols are the positions of the pushed down columns for this item.
+	cols []int
+}
+
+// aggregation is a SELECT with aggregate functions or GROUP BY, which S3 Select
+// can only evaluate per object. Each object is queried with a pushed down query,
+// and the partial results are merged client-side.
+type aggregation struct {
+	items   []*aggItem
+	from    string
+	where   string
+	groupBy []string
+	limit   int
+}
+
+// parseAggregation returns nil when the query has neither aggregate functions nor GROUP BY.
+func parseAggregation(query string) (*aggregation, error) {
+	// the clauses are found in the query without quoted strings, such as 'a GROUP BY b' in WHERE.
+	index := aggQueryRep.FindStringSubmatchIndex(maskQuoted(query))
+	if index == nil {
+		return nil, nil
+	}
+	m := make([]string, len(index)/2)
+	for i := range m {
+		if index[2*i] >= 0 {
+			m[i] = query[index[2*i]:index[2*i+1]]
+		}
+	}
+
+	agg := &aggregation{
+		from:  m[2],
+		where: m[3],
+	}
+	if m[4] != "" {
+		agg.groupBy = splitTopLevel(m[4])
+	}
+	if m[5] != "" {
+		limit, err := strconv.Atoi(m[5])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		agg.limit = limit
+	}
+
+	var hasAggFunc bool
+	for i, s := range splitTopLevel(m[1]) {
+		item := &aggItem{
+			expr:  s,
+			alias: "_" + strconv.Itoa(i+1),
+		}
+		if am := aggAliasRep.FindStringSubmatch(s); am != nil {
+			item.expr = strings.TrimSpace(am[1])
+			item.alias = strings.Trim(am[2], `"`)
+		} else if pm := aggPathRep.FindStringSubmatch(s); pm != nil {
+			item.alias = strings.Trim(pm[1], `"`)
+		}
+		if fm := aggFuncRep.FindStringSubmatch(item.expr); fm != nil {
+			switch strings.ToUpper(fm[1]) {
+			case "COUNT":
+				item.fn = aggCount
+			case "SUM":
+				item.fn = aggSum
+			case "AVG":
+				item.fn = aggAvg
+			case "MIN":
+				item.fn = aggMin
+			case "MAX":
+				item.fn = aggMax
+			}
+			item.expr = fm[2]
+			hasAggFunc = true
+		}
+		agg.items = append(agg.items, item)
+	}
+
+	if !hasAggFunc && len(agg.groupBy) == 0 {
+		return nil, nil
+	}
+
+	if err := agg.assignColumns(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return agg, nil
+}
+
+func (agg *aggregation) assignColumns() error {
+	var col int
+	if len(agg.groupBy) == 0 {
+		for _, item := range agg.items {
+			switch item.fn {
+			case aggNone:
+				return errors.Errorf("%s must be in GROUP BY or an aggregate function", item.expr)
+			case aggAvg:
+				item.cols = []int{col, col + 1}
+				col += 2
+			default:
+				item.cols = []int{col}
+				col++
+			}
+		}
+		return nil
+	}
+
+	col = len(agg.groupBy)
+	for _, item := range agg.items {
+		if item.fn == aggNone {
+			i := agg.groupByIndex(item.expr)
+			if i < 0 {
+				return errors.Errorf("%s must be in GROUP BY or an aggregate function", item.expr)
+			}
+			item.cols = []int{i}
+			continue
+		}
+		if item.expr == "*" {
+			continue
+		}
+		item.cols = []int{col}
+		col++
+	}
+	return nil
+}
+
+func (agg *aggregation) groupByIndex(expr string) int {
+	for i, g := range agg.groupBy {
+		if normalizeExpr(g) == normalizeExpr(expr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// pushdownQuery returns the query run on each object.
+// Without GROUP BY it computes partial aggregates, otherwise it projects the
+// grouping and aggregated expressions of every matched record.
+func (agg *aggregation) pushdownQuery() string {
+	var cols []string
+	if len(agg.groupBy) == 0 {
+		for _, item := range agg.items {
+			switch item.fn {
+			case aggCount:
+				cols = append(cols, "COUNT("+item.expr+")")
+			case aggSum:
+				cols = append(cols, "SUM("+item.expr+")")
+			case aggAvg:
+				cols = append(cols, "SUM("+item.expr+")", "COUNT("+item.expr+")")
+			case aggMin:
+				cols = append(cols, "MIN("+item.expr+")")
+			case aggMax:
+				cols = append(cols, "MAX("+item.expr+")")
+			}
+		}
+	} else {
+		cols = append(cols, agg.groupBy...)
+		for _, item := range agg.items {
+			if item.fn != aggNone && item.expr != "*" {
+				cols = append(cols, item.expr)
+			}
+		}
+	}
+
+	for i := range cols {
+		cols[i] += " AS " + pushdownColumn(i)
+	}
+
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + agg.from
+	if agg.where != "" {
+		query += " WHERE " + agg.where
+	}
+	return query
+}
+
+func pushdownColumn(i int) string {
+	return "c" + strconv.Itoa(i+1)
+}
+
+type aggGroup struct {
+	values []interface{}
+	accs   []*accumulator
+}
+
+func (agg *aggregation) newGroup(values []interface{}) *aggGroup {
+	group := &aggGroup{
+		values: values,
+		accs:   make([]*accumulator, len(agg.items)),
+	}
+	for i := range group.accs {
+		group.accs[i] = &accumulator{}
+	}
+	return group
+}
+
+type accumulator struct {
+	count  float64
+	sum    float64
+	hasSum bool
+	value  interface{}
+}
+
+func (c *Client) aggregate(ctx context.Context, agg *aggregation, out <-chan []byte, in chan<- []byte) error {
+	defer close(in)
+
+	groups := map[string]*aggGroup{}
+	for {
+		select {
+		case b, ok := <-out:
+			if !ok {
+				for _, row := range agg.rows(groups) {
+					select {
+					case in <- row:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+				return nil
+			}
+
+			if err := agg.merge(groups, b); err != nil {
+				return errors.WithStack(err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (agg *aggregation) merge(groups map[string]*aggGroup, b []byte) error {
+	var row map[string]interface{}
+	if err := json.Unmarshal(b, &row); err != nil {
+		return errors.WithStack(err)
+	}
+
+	values := make([]interface{}, len(agg.groupBy))
+	for i := range agg.groupBy {
+		values[i] = row[pushdownColumn(i)]
+	}
+	groupKey, err := json.Marshal(values)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	group, ok := groups[string(groupKey)]
+	if !ok {
+		group = agg.newGroup(values)
+		groups[string(groupKey)] = group
+	}
+
+	partial := len(agg.groupBy) == 0
+	for i, item := range agg.items {
+		acc := group.accs[i]
+		var v interface{}
+		if len(item.cols) > 0 {
+			v = row[pushdownColumn(item.cols[0])]
+		}
+
+		switch item.fn {
+		case aggCount:
+			if partial {
+				if n, ok := toFloat(v); ok {
+					acc.count += n
+				}
+			} else if item.expr == "*" || v != nil {
+				acc.count++
+			}
+		case aggSum:
+			if n, ok := toFloat(v); ok {
+				acc.sum += n
+				acc.hasSum = true
+			}
+		case aggAvg:
+			if n, ok := toFloat(v); ok {
+				acc.sum += n
+				acc.hasSum = true
+				if partial {
+					if n, ok := toFloat(row[pushdownColumn(item.cols[1])]); ok {
+						acc.count += n
+					}
+				} else {
+					acc.count++
+				}
+			}
+		case aggMin:
+			if v != nil && (acc.value == nil || compareValue(v, acc.value) < 0) {
+				acc.value = v
+			}
+		case aggMax:
+			if v != nil && (acc.value == nil || compareValue(v, acc.value) > 0) {
+				acc.value = v
+			}
+		}
+	}
+
+	return nil
+}
+
+func (agg *aggregation) rows(groups map[string]*aggGroup) [][]byte {
+	if len(agg.groupBy) == 0 && len(groups) == 0 {
+		groups["[]"] = agg.newGroup(nil)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if agg.limit > 0 && len(keys) > agg.limit {
+		keys = keys[:agg.limit]
+	}
+
+	rows := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, item := range agg.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(item.alias)
+			buf.Write(name)
+			buf.WriteByte(':')
+
+			var v interface{}
+			acc := group.accs[i]
+			switch item.fn {
+			case aggNone:
+				v = group.values[item.cols[0]]
+			case aggCount:
+				v = acc.count
+			case aggSum:
+				if acc.hasSum {
+					v = acc.sum
+				}
+			case aggAvg:
+				if acc.count > 0 {
+					v = acc.sum / acc.count
+				}
+			case aggMin, aggMax:
+				v = acc.value
+			}
+			value, _ := json.Marshal(v)
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+		rows = append(rows, buf.Bytes())
+	}
+
+	return rows
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func compareValue(a, b interface{}) int {
+	an, aok := toFloat(a)
+	bn, bok := toFloat(b)
+	if aok && bok {
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func normalizeExpr(expr string) string {
+	return strings.ToLower(strings.Join(strings.Fields(expr), ""))
+}
+
+// maskQuoted replaces the characters in quotes with x, keeping the byte offsets of s.
+func maskQuoted(s string) string {
+	b := []byte(s)
+	var quote byte
+	for i := range b {
+		switch {
+		case quote != 0:
+			if b[i] == quote {
+				quote = 0
+			} else {
+				b[i] = 'x'
+			}
+		case b[i] == '\'' || b[i] == '"' || b[i] == '`':
+			quote = b[i]
+		}
+	}
+	return string(b)
+}
+
+// splitTopLevel splits s by commas outside of parentheses and quotes.
+func splitTopLevel(s string) []string {
+	var (
+		parts []string
+		depth int
+		quote rune
+		start int
+	)
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,179 @@
+package s3s
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseAggregation(t *testing.T) {
+	cases := []struct {
+		name    string
+		query   string
+		want    string
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name:    "no aggregation",
+			query:   "SELECT * FROM S3Object s WHERE s.type = 'speak' LIMIT 10",
+			wantNil: true,
+		},
+		{
+			name:  "count and sum",
+			query: "SELECT COUNT(*), SUM(CAST(s._12 AS INT)) FROM S3Object s WHERE s._9 = '200'",
+			want:  "SELECT COUNT(*) AS c1, SUM(CAST(s._12 AS INT)) AS c2 FROM S3Object s WHERE s._9 = '200'",
+		},
+		{
+			name:  "avg as sum and count",
+			query: "SELECT AVG(s.latency) AS latency FROM S3Object s",
+			want:  "SELECT SUM(s.latency) AS c1, COUNT(s.latency) AS c2 FROM S3Object s",
+		},
+		{
+			name:  "group by",
+			query: "SELECT s._9, COUNT(*), MAX(s._7) FROM S3Object s WHERE s._1 = 'https' GROUP BY s._9",
+			want:  "SELECT s._9 AS c1, s._7 AS c2 FROM S3Object s WHERE s._1 = 'https'",
+		},
+		{
+			name:  "group by in a string",
+			query: "SELECT COUNT(*) FROM S3Object s WHERE s.x = 'a GROUP BY b'",
+			want:  "SELECT COUNT(*) AS c1 FROM S3Object s WHERE s.x = 'a GROUP BY b'",
+		},
+		{
+			name:    "group by in a string without aggregation",
+			query:   "SELECT * FROM S3Object s WHERE s.x = 'a GROUP BY b'",
+			wantNil: true,
+		},
+		{
+			name:  "limit in a string",
+			query: "SELECT COUNT(*) FROM S3Object s WHERE s.x LIKE '%LIMIT 5'",
+			want:  "SELECT COUNT(*) AS c1 FROM S3Object s WHERE s.x LIKE '%LIMIT 5'",
+		},
+		{
+			name:  "limit in a string before the limit",
+			query: "SELECT s.x, COUNT(*) FROM S3Object s WHERE s.x LIKE '% LIMIT 5' GROUP BY s.x LIMIT 3",
+			want:  "SELECT s.x AS c1 FROM S3Object s WHERE s.x LIKE '% LIMIT 5'",
+		},
+		{
+			name:    "column not in group by",
+			query:   "SELECT s._3, COUNT(*) FROM S3Object s GROUP BY s._9",
+			wantErr: true,
+		},
+		{
+			name:    "column without group by",
+			query:   "SELECT s._3, COUNT(*) FROM S3Object s",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseAggregation(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("want nil, but got = %+v", got)
+				}
+				return
+			}
+			if q := got.pushdownQuery(); q != tt.want {
+				t.Errorf("want = %s,\nbut got = %s", tt.want, q)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		rows  []string
+		want  []string
+	}{
+		{
+			name:  "merge partial aggregates",
+			query: "SELECT COUNT(*), SUM(s.bytes) AS bytes, AVG(s.latency), MIN(s.latency), MAX(s.latency) FROM S3Object s",
+			rows: []string{
+				`{"c1":2,"c2":30,"c3":3,"c4":2,"c5":1,"c6":2}`,
+				`{"c1":3,"c2":70,"c3":9,"c4":3,"c5":2,"c6":5}`,
+			},
+			want: []string{
+				`{"_1":5,"bytes":100,"_3":2.4,"_4":1,"_5":5}`,
+			},
+		},
+		{
+			name:  "no rows",
+			query: "SELECT COUNT(*), SUM(s.bytes) FROM S3Object s",
+			rows:  nil,
+			want: []string{
+				`{"_1":0,"_2":null}`,
+			},
+		},
+		{
+			name:  "group by",
+			query: "SELECT s.status AS status, COUNT(*) AS count, SUM(s.bytes) AS bytes FROM S3Object s GROUP BY s.status LIMIT 2",
+			rows: []string{
+				`{"c1":"200","c2":"10"}`,
+				`{"c1":"500","c2":"1"}`,
+				`{"c1":"200","c2":"20"}`,
+				`{"c1":"404","c2":"5"}`,
+			},
+			want: []string{
+				`{"status":"200","count":2,"bytes":30}`,
+				`{"status":"404","count":1,"bytes":5}`,
+			},
+		},
+		{
+			name:  "group by without alias",
+			query: `SELECT s.status, s."user-agent", UPPER(s.method), COUNT(*) FROM S3Object s GROUP BY s.status, s."user-agent", UPPER(s.method)`,
+			rows: []string{
+				`{"c1":"200","c2":"curl","c3":"GET"}`,
+				`{"c1":"200","c2":"curl","c3":"GET"}`,
+			},
+			want: []string{
+				`{"status":"200","user-agent":"curl","_3":"GET","_4":2}`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			agg, err := parseAggregation(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := make(chan []byte, len(tt.rows))
+			for _, row := range tt.rows {
+				out <- []byte(row)
+			}
+			close(out)
+
+			in := make(chan []byte, 10)
+			c := &Client{}
+			if err := c.aggregate(context.Background(), agg, out, in); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for b := range in {
+				got = append(got, string(b))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package s3s
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Checkpoint records each key completed by Run as a JSON line, and Run skips the keys loaded from a previous run.
+// A key is recorded after all of its records are written to Option.Output, so a resumed run loses no records,
+// and each key is written at least once. A key partly written before the previous run died is written again from the start.
+type Checkpoint struct {
+	mu      sync.Mutex
+	w       io.Writer
+	done    map[CheckpointEntry]bool
+	pending []pendingEntry
+}
+
+// CheckpointEntry is a completed key. A key rewritten after the checkpoint has another ETag, and is selected again.
+type CheckpointEntry struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	ETag   string `json:"etag"`
+}
+
+type pendingEntry struct {
+	entry CheckpointEntry
+	// seq is the number of records sent when the key is completed, so the key is done when they are written.
+	seq int64
+}
+
+func NewCheckpoint(w io.Writer) *Checkpoint {
+	return &Checkpoint{
+		w:    w,
+		done: map[CheckpointEntry]bool{},
+	}
+}
+
+// Load reads the completed keys, ignoring a broken line such as the last one of a killed run.
+func (c *Checkpoint) Load(r io.Reader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry CheckpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		c.done[entry] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Len is the number of completed keys loaded or recorded.
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.done)
+}
+
+func (c *Checkpoint) isDone(bucket string, key string, etag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[CheckpointEntry{Bucket: bucket, Key: key, ETag: etag}]
+}
+
+// complete records the key after the records sent so far are written.
+func (c *Checkpoint) complete(object s3Object, seq int64, stats *selectStats) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, pendingEntry{
+		entry: CheckpointEntry{Bucket: object.Bucket, Key: object.Key, ETag: object.ETag},
+		seq:   seq,
+	})
+	return c.flushLocked(stats.emitted.Load())
+}
+
+// flush records the keys whose records are all written.
+func (c *Checkpoint) flush(emitted int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked(emitted)
+}
+
+func (c *Checkpoint) flushLocked(emitted int64) error {
+	rest := c.pending[:0]
+	for _, p := range c.pending {
+		if p.seq > emitted {
+			rest = append(rest, p)
+			continue
+		}
+		b, err := json.Marshal(p.entry)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := c.w.Write(append(b, '\n')); err != nil {
+			return errors.WithStack(err)
+		}
+		c.done[p.entry] = true
+	}
+	c.pending = rest
+	return nil
+}
@@ -0,0 +1,148 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointLoad(t *testing.T) {
+	input := `{"bucket":"bucket","key":"a.json","etag":"\"1\""}` + "\n" +
+		`{"bucket":"bucket","key":"b.json","etag":"\"2\""}` + "\n" +
+		`{"bucket":"bucket","key":"c.js`
+
+	checkpoint := NewCheckpoint(&bytes.Buffer{})
+	if err := checkpoint.Load(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkpoint.Len(); got != 2 {
+		t.Errorf("want = %d, but got = %d", 2, got)
+	}
+	if !checkpoint.isDone("bucket", "b.json", `"2"`) {
+		t.Errorf("want b.json done")
+	}
+	if checkpoint.isDone("bucket", "b.json", `"3"`) {
+		t.Errorf("want b.json with another etag not done")
+	}
+}
+
+func TestRunCheckpoint(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"a":1}` + "\n"),
+				"prefix/b.json": []byte(`{"a":2}` + "\n"),
+				"prefix/c.json": []byte(`{"a":3}` + "\n"),
+			},
+		},
+		keyErr: map[string]error{
+			"prefix/b.json": &fakeAPIError{code: "ExpiredToken"},
+		},
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	var first, saved bytes.Buffer
+	option := &Option{Output: &first, EngineType: EngineTypeS3Select, ContinueOnError: true, Checkpoint: NewCheckpoint(&saved)}
+	if _, err := NewFromAPI(api, WithSelectRetries(0)).Run(context.Background(), []string{"s3://bucket/prefix"}, query, option); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(saved.String(), "\n"); got != 2 {
+		t.Fatalf("want = %d, but got = %d", 2, got)
+	}
+
+	// b.json is recovered, and c.json is rewritten after the first run.
+	api.keyErr = nil
+	api.objects["bucket"]["prefix/c.json"] = []byte(`{"a":4}` + "\n")
+
+	var second bytes.Buffer
+	checkpoint := NewCheckpoint(&saved)
+	if err := checkpoint.Load(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &second, EngineType: EngineTypeS3Select, Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ResumedCount != 1 {
+		t.Errorf("want = %d, but got = %d", 1, result.ResumedCount)
+	}
+	got := strings.Split(strings.TrimSpace(second.String()), "\n")
+	sort.Strings(got)
+	want := []string{`{"a":2}`, `{"a":4}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+	if got := checkpoint.Len(); got != 4 {
+		t.Errorf("want = %d, but got = %d", 4, got)
+	}
+}
+
+// cancelWriter cancels the context after n lines, like Ctrl-C in the middle of an object.
+type cancelWriter struct {
+	bytes.Buffer
+	n      int
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	n, err := w.Buffer.Write(p)
+	if strings.Count(w.Buffer.String(), "\n") >= w.n {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestRunCheckpointCancel(t *testing.T) {
+	var body []byte
+	for i := 0; i < 50; i++ {
+		body = append(body, fmt.Sprintf(`{"a":%d}`+"\n", i)...)
+	}
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": body,
+			},
+		},
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	for _, engineType := range []EngineType{EngineTypeS3Select, EngineTypeLocal} {
+		engineType := engineType
+		t.Run(fmt.Sprintf("engine %d", engineType), func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var saved bytes.Buffer
+			output := &cancelWriter{n: 3, cancel: cancel}
+			option := &Option{Output: output, EngineType: engineType, Checkpoint: NewCheckpoint(&saved)}
+			if _, err := NewFromAPI(api).Run(ctx, []string{"s3://bucket/prefix"}, query, option); err == nil {
+				t.Errorf("want error, but got nil")
+			}
+			if saved.Len() != 0 {
+				t.Errorf("want no completed key, but got = %s", saved.String())
+			}
+		})
+	}
+}
+
+func TestRunCheckpointCountMode(t *testing.T) {
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT COUNT(*) FROM S3Object s",
+	}
+	option := &Option{IsCountMode: true, Checkpoint: NewCheckpoint(&bytes.Buffer{})}
+	if _, err := NewFromAPI(&fakeS3{}).Run(context.Background(), []string{"s3://bucket/prefix"}, query, option); err == nil {
+		t.Errorf("want error, but got nil")
+	}
+}
@@ -0,0 +1,143 @@
+package s3s
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type clientConfig struct {
+	region            string
+	profile           string
+	endpoint          string
+	usePathStyle      bool
+	maxAttempts       int
+	listConcurrency   int
+	selectConcurrency int
+	selectRetries     int
+	selectRetryDelay  time.Duration
+	scanRangeSize     int64
+}
+
+func newClientConfig(opts []ClientOption) *clientConfig {
+	cfg := &clientConfig{
+		listConcurrency:   DEFAULT_THREAD_COUNT,
+		selectConcurrency: DEFAULT_THREAD_COUNT,
+		selectRetries:     DEFAULT_SELECT_RETRIES,
+		selectRetryDelay:  DEFAULT_SELECT_RETRY_DELAY,
+		scanRangeSize:     DEFAULT_SCAN_RANGE_SIZE,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func (cfg *clientConfig) loadOptions() []func(*config.LoadOptions) error {
+	var opts []func(*config.LoadOptions) error
+	if cfg.region != "" {
+		opts = append(opts, config.WithRegion(cfg.region))
+	}
+	if cfg.profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(cfg.profile))
+	}
+	if cfg.maxAttempts > 0 {
+		opts = append(opts, config.WithRetryMaxAttempts(cfg.maxAttempts))
+	}
+	return opts
+}
+
+func (cfg *clientConfig) s3Options(o *s3.Options) {
+	if cfg.endpoint != "" {
+		o.BaseEndpoint = aws.String(cfg.endpoint)
+	}
+	o.UsePathStyle = cfg.usePathStyle
+}
+
+// ClientOption configures a Client created by New or NewFromAPI.
+type ClientOption func(*clientConfig)
+
+// WithRegion sets the region of the target buckets instead of AWS_REGION.
+func WithRegion(region string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.region = region
+	}
+}
+
+// WithProfile sets the shared config profile used to load credentials.
+func WithProfile(profile string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.profile = profile
+	}
+}
+
+// WithEndpoint sets a custom endpoint URL such as an S3-compatible store.
+func WithEndpoint(endpoint string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.endpoint = endpoint
+	}
+}
+
+// WithPathStyle addresses buckets as https://host/bucket instead of https://bucket.host.
+func WithPathStyle(usePathStyle bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.usePathStyle = usePathStyle
+	}
+}
+
+// WithMaxAttempts sets the max number of attempts of each API request, including the first one.
+// So 1 disables retries, and zero uses the default of the SDK, which is 3.
+func WithMaxAttempts(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.maxAttempts = n
+	}
+}
+
+// WithListConcurrency sets the max number of prefixes listed concurrently.
+func WithListConcurrency(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		if n > 0 {
+			cfg.listConcurrency = n
+		}
+	}
+}
+
+// WithSelectConcurrency sets the max number of S3 Select requests run concurrently.
+func WithSelectConcurrency(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		if n > 0 {
+			cfg.selectConcurrency = n
+		}
+	}
+}
+
+// WithSelectRetries sets the max number of retries for each object failed with a retryable error such as SlowDown.
+// Zero disables retries.
+func WithSelectRetries(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		if n >= 0 {
+			cfg.selectRetries = n
+		}
+	}
+}
+
+// WithSelectRetryDelay sets the base delay of the jittered exponential backoff between retries.
+func WithSelectRetryDelay(d time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		if d > 0 {
+			cfg.selectRetryDelay = d
+		}
+	}
+}
+
+// WithScanRangeSize sets the size of the byte ranges which a large object is split into and selected concurrently.
+// Zero disables splitting.
+func WithScanRangeSize(size int64) ClientOption {
+	return func(cfg *clientConfig) {
+		if size >= 0 {
+			cfg.scanRangeSize = size
+		}
+	}
+}
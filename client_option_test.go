@@ -0,0 +1,140 @@
+package s3s
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestNewFromAPI(t *testing.T) {
+	cases := []struct {
+		name       string
+		opts       []ClientOption
+		wantList   int
+		wantSelect int
+	}{
+		{
+			name:       "default",
+			opts:       nil,
+			wantList:   DEFAULT_THREAD_COUNT,
+			wantSelect: DEFAULT_THREAD_COUNT,
+		},
+		{
+			name:       "with concurrency",
+			opts:       []ClientOption{WithListConcurrency(10), WithSelectConcurrency(20)},
+			wantList:   10,
+			wantSelect: 20,
+		},
+		{
+			name:       "ignore non-positive concurrency",
+			opts:       []ClientOption{WithListConcurrency(0), WithSelectConcurrency(-1)},
+			wantList:   DEFAULT_THREAD_COUNT,
+			wantSelect: DEFAULT_THREAD_COUNT,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewFromAPI(&fakeS3{}, tt.opts...)
+			if got.listConcurrency != tt.wantList {
+				t.Errorf("want = %d, but got = %d", tt.wantList, got.listConcurrency)
+			}
+			if got.selectConcurrency != tt.wantSelect {
+				t.Errorf("want = %d, but got = %d", tt.wantSelect, got.selectConcurrency)
+			}
+		})
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	cases := []struct {
+		name         string
+		opts         []ClientOption
+		wantRegion   string
+		wantProfile  string
+		wantAttempts int
+	}{
+		{
+			name: "default",
+			opts: nil,
+		},
+		{
+			name:         "with all",
+			opts:         []ClientOption{WithRegion("ap-northeast-1"), WithProfile("dev"), WithMaxAttempts(5)},
+			wantRegion:   "ap-northeast-1",
+			wantProfile:  "dev",
+			wantAttempts: 5,
+		},
+		{
+			name:         "no retries",
+			opts:         []ClientOption{WithMaxAttempts(1)},
+			wantAttempts: 1,
+		},
+		{
+			name:         "ignore non-positive attempts",
+			opts:         []ClientOption{WithMaxAttempts(0)},
+			wantAttempts: 0,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got config.LoadOptions
+			for _, opt := range newClientConfig(tt.opts).loadOptions() {
+				if err := opt(&got); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got.Region != tt.wantRegion {
+				t.Errorf("want = %s, but got = %s", tt.wantRegion, got.Region)
+			}
+			if got.SharedConfigProfile != tt.wantProfile {
+				t.Errorf("want = %s, but got = %s", tt.wantProfile, got.SharedConfigProfile)
+			}
+			if got.RetryMaxAttempts != tt.wantAttempts {
+				t.Errorf("want = %d, but got = %d", tt.wantAttempts, got.RetryMaxAttempts)
+			}
+		})
+	}
+}
+
+func TestS3Options(t *testing.T) {
+	cases := []struct {
+		name          string
+		opts          []ClientOption
+		wantEndpoint  string
+		wantPathStyle bool
+	}{
+		{
+			name: "default",
+			opts: nil,
+		},
+		{
+			name:          "with endpoint and path style",
+			opts:          []ClientOption{WithEndpoint("http://localhost:9000"), WithPathStyle(true)},
+			wantEndpoint:  "http://localhost:9000",
+			wantPathStyle: true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got s3.Options
+			newClientConfig(tt.opts).s3Options(&got)
+			if aws.ToString(got.BaseEndpoint) != tt.wantEndpoint {
+				t.Errorf("want = %s, but got = %s", tt.wantEndpoint, aws.ToString(got.BaseEndpoint))
+			}
+			if got.UsePathStyle != tt.wantPathStyle {
+				t.Errorf("want = %t, but got = %t", tt.wantPathStyle, got.UsePathStyle)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"time"
 
+	"github.com/dustin/go-humanize"
+	"github.com/koluku/s3s"
 	"github.com/pkg/errors"
 )
 
@@ -40,30 +42,97 @@ func checkTime(duration time.Duration, until, since time.Time) error {
 	return nil
 }
 
-func checkQuery(queryStr string, where string, limit int, isCount bool) error {
+func checkQuery(queryStr string, where string, limit int, isCount bool, countBy string) error {
 	if queryStr != "" {
 		if where != "" {
 			return errors.Errorf("can't use query option with query option")
 		}
-		if limit != 0 {
-			return errors.Errorf("can't use query option with limit option")
+	}
+	if limit < 0 {
+		return errors.Errorf("minus limit error")
+	}
+	if countBy != "" {
+		if !isCount {
+			return errors.Errorf("count-by option needs count option")
+		}
+		if countBy != COUNT_BY_KEY && countBy != COUNT_BY_PREFIX {
+			return errors.Errorf("count-by option must be %q or %q", COUNT_BY_KEY, COUNT_BY_PREFIX)
 		}
 	}
 
 	return nil
 }
 
-func checkFileFormat(isCSV bool, isALBLogs bool, isCFLogs bool) error {
+func checkFileFormat(isCSV bool, isALBLogs bool, isNLBLogs bool, isCLBLogs bool, isCFLogs bool, isVPCFlowLogs bool, isCloudTrail bool, isS3AccessLogs bool, isWAFLogs bool, isParquet bool) error {
 	var count int
-	for _, format := range []bool{isCSV, isALBLogs, isCFLogs} {
+	for _, format := range []bool{isCSV, isALBLogs, isNLBLogs, isCLBLogs, isCFLogs, isVPCFlowLogs, isCloudTrail, isS3AccessLogs, isWAFLogs, isParquet} {
 		if format {
 			count++
 		}
 	}
 
 	if count > 1 {
-		return errors.Errorf("too many option: --csv, --alb-logs or --cf-logs")
+		return errors.Errorf("too many option: --csv, --alb-logs, --nlb-logs, --clb-logs, --cf-logs, --vpc-flow-logs, --cloudtrail, --s3-access-logs, --waf-logs or --parquet")
 	}
 
 	return nil
 }
+
+const (
+	ENGINE_AUTO      = "auto"
+	ENGINE_S3_SELECT = "s3select"
+	ENGINE_LOCAL     = "local"
+)
+
+func parseEngine(engine string) (s3s.EngineType, error) {
+	switch engine {
+	case ENGINE_AUTO:
+		return s3s.EngineTypeAuto, nil
+	case ENGINE_S3_SELECT:
+		return s3s.EngineTypeS3Select, nil
+	case ENGINE_LOCAL:
+		return s3s.EngineTypeLocal, nil
+	default:
+		return 0, errors.Errorf("unknown engine: %s", engine)
+	}
+}
+
+const (
+	ARCHIVE_SKIP = "skip"
+	ARCHIVE_WARN = "warn"
+	ARCHIVE_FAIL = "fail"
+)
+
+func parseArchivePolicy(archive string) (s3s.ArchivePolicy, error) {
+	switch archive {
+	case ARCHIVE_SKIP:
+		return s3s.ArchivePolicySkip, nil
+	case ARCHIVE_WARN:
+		return s3s.ArchivePolicyWarn, nil
+	case ARCHIVE_FAIL:
+		return s3s.ArchivePolicyFail, nil
+	default:
+		return 0, errors.Errorf("unknown archive policy: %s", archive)
+	}
+}
+
+// parseSizeRange returns zero for an empty size, which means no limit.
+func parseSizeRange(minSize string, maxSize string) (int64, int64, error) {
+	var sizes [2]int64
+	for i, size := range []string{minSize, maxSize} {
+		if size == "" {
+			continue
+		}
+		b, err := humanize.ParseBytes(size)
+		if err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+		sizes[i] = int64(b)
+	}
+
+	if sizes[0] > 0 && sizes[1] > 0 && sizes[0] > sizes[1] {
+		return 0, 0, errors.Errorf("min-size > max-size error")
+	}
+
+	return sizes[0], sizes[1], nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/koluku/s3s"
+	"github.com/pkg/errors"
+)
+
+// openCheckpoint loads the completed keys when resume, and appends new ones to the same file.
+func openCheckpoint(path string, isResume bool) (*s3s.Checkpoint, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	checkpoint := s3s.NewCheckpoint(f)
+	if !isResume {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, errors.WithStack(err)
+		}
+		if info.Size() > 0 {
+			f.Close()
+			return nil, nil, errors.Errorf("checkpoint %s already exists, use resume option or remove it", path)
+		}
+		return checkpoint, f, nil
+	}
+
+	if err := checkpoint.Load(f); err != nil {
+		f.Close()
+		return nil, nil, errors.WithStack(err)
+	}
+	return checkpoint, f, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "saved.jsonl")
+	if err := os.WriteFile(saved, []byte(`{"bucket":"bucket","key":"a.json","etag":"\"1\""}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		path     string
+		isResume bool
+		wantLen  int
+		wantErr  bool
+	}{
+		{
+			name:    "new",
+			path:    filepath.Join(dir, "new.jsonl"),
+			wantLen: 0,
+		},
+		{
+			name:     "resume",
+			path:     saved,
+			isResume: true,
+			wantLen:  1,
+		},
+		{
+			name:     "resume without file",
+			path:     filepath.Join(dir, "none.jsonl"),
+			isResume: true,
+			wantLen:  0,
+		},
+		{
+			name:    "overwrite",
+			path:    saved,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint, closer, err := openCheckpoint(tt.path, tt.isResume)
+			if tt.wantErr {
+				if err == nil {
+					closer.Close()
+					t.Errorf("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closer.Close()
+			if got := checkpoint.Len(); got != tt.wantLen {
+				t.Errorf("want = %d, but got = %d", tt.wantLen, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/koluku/s3s"
+	"github.com/pkg/errors"
+)
+
+// loadPrice returns the price of the region from the default table overridden by the JSON file.
+func loadPrice(path string, region string) (s3s.Price, error) {
+	table := s3s.PriceTable{}
+	for r, price := range s3s.DefaultPriceTable {
+		table[r] = price
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return s3s.Price{}, errors.WithStack(err)
+		}
+		var custom s3s.PriceTable
+		if err := json.Unmarshal(b, &custom); err != nil {
+			return s3s.Price{}, errors.Wrapf(err, "invalid price table %s", path)
+		}
+		for r, price := range custom {
+			table[r] = price
+		}
+	}
+
+	price, ok := table.Lookup(region)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "no price for region %q, use %s instead\n", region, s3s.DEFAULT_PRICE_REGION)
+	}
+	return price, nil
+}
+
+func printCost(cost s3s.Cost) {
+	fmt.Printf("scan cost: $%.4f\n", cost.Scan)
+	fmt.Printf("return cost: $%.4f (upper bound)\n", cost.Return)
+	fmt.Printf("list request cost: $%.4f\n", cost.List)
+	fmt.Printf("select request cost: $%.4f\n", cost.Select)
+	fmt.Printf("estimated cost: $%.4f\n", cost.Total())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/koluku/s3s"
+)
+
+func TestLoadPrice(t *testing.T) {
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "price.json")
+	if err := os.WriteFile(custom, []byte(`{"ap-northeast-1":{"scan_per_gb":0.00225,"return_per_gb":0.0008,"list_per_1000":0.0047,"select_per_1000":0.00037}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		region  string
+		want    s3s.Price
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			region: "us-west-2",
+			want:   s3s.DefaultPriceTable["us-west-2"],
+		},
+		{
+			name:   "custom region",
+			path:   custom,
+			region: "ap-northeast-1",
+			want:   s3s.Price{ScanPerGB: 0.00225, ReturnPerGB: 0.0008, ListPer1000: 0.0047, SelectPer1000: 0.00037},
+		},
+		{
+			name:   "default with custom table",
+			path:   custom,
+			region: "us-east-1",
+			want:   s3s.DefaultPriceTable["us-east-1"],
+		},
+		{
+			name:    "invalid table",
+			path:    invalid,
+			region:  "us-east-1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := loadPrice(tt.path, tt.region)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want = %+v, but got = %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/koluku/s3s"
+)
+
+const (
+	COUNT_BY_KEY    = "key"
+	COUNT_BY_PREFIX = "prefix"
+)
+
+func printCount(result *s3s.Result, countBy string) {
+	for _, c := range breakdownCount(result.KeyCounts, countBy) {
+		fmt.Printf("%d\t%s\n", c.Count, c.Path)
+	}
+	fmt.Println(result.Total)
+}
+
+type pathCount struct {
+	Path  string
+	Count int
+}
+
+func breakdownCount(keyCounts []s3s.KeyCount, countBy string) []pathCount {
+	if countBy == "" {
+		return nil
+	}
+
+	counts := map[string]int{}
+	for _, kc := range keyCounts {
+		var p string
+		switch countBy {
+		case COUNT_BY_KEY:
+			p = fmt.Sprintf("s3://%s/%s", kc.Bucket, kc.Key)
+		case COUNT_BY_PREFIX:
+			dir := path.Dir(kc.Key)
+			if dir == "." {
+				p = fmt.Sprintf("s3://%s/", kc.Bucket)
+			} else {
+				p = fmt.Sprintf("s3://%s/%s/", kc.Bucket, dir)
+			}
+		}
+		counts[p] += kc.Count
+	}
+
+	paths := make([]pathCount, 0, len(counts))
+	for p, count := range counts {
+		paths = append(paths, pathCount{Path: p, Count: count})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Path < paths[j].Path
+	})
+
+	return paths
+}
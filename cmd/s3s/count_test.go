@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koluku/s3s"
+)
+
+func TestBreakdownCount(t *testing.T) {
+	keyCounts := []s3s.KeyCount{
+		{Bucket: "bucket", Key: "logs/2022/09/28/b.json", Count: 2},
+		{Bucket: "bucket", Key: "logs/2022/09/28/a.json", Count: 1},
+		{Bucket: "bucket", Key: "logs/2022/09/29/c.json", Count: 4},
+	}
+
+	cases := []struct {
+		name    string
+		countBy string
+		want    []pathCount
+	}{
+		{
+			name:    "none",
+			countBy: "",
+			want:    nil,
+		},
+		{
+			name:    "key",
+			countBy: COUNT_BY_KEY,
+			want: []pathCount{
+				{Path: "s3://bucket/logs/2022/09/28/a.json", Count: 1},
+				{Path: "s3://bucket/logs/2022/09/28/b.json", Count: 2},
+				{Path: "s3://bucket/logs/2022/09/29/c.json", Count: 4},
+			},
+		},
+		{
+			name:    "prefix",
+			countBy: COUNT_BY_PREFIX,
+			want: []pathCount{
+				{Path: "s3://bucket/logs/2022/09/28/", Count: 3},
+				{Path: "s3://bucket/logs/2022/09/29/", Count: 4},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := breakdownCount(keyCounts, tt.countBy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %+v,\nbut got = %+v", tt.want, got)
+			}
+		})
+	}
+}
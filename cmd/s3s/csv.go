@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/koluku/s3s"
+	"github.com/pkg/errors"
+)
+
+// buildCSVOption returns nil when no csv option is set.
+func buildCSVOption(header, fieldDelimiter, recordDelimiter, quote, comment string) (*s3s.CSVOption, error) {
+	if header == "" && fieldDelimiter == "" && recordDelimiter == "" && quote == "" && comment == "" {
+		return nil, nil
+	}
+
+	option := &s3s.CSVOption{}
+	switch strings.ToUpper(header) {
+	case "":
+	case string(s3s.CSVHeaderInfoNone):
+		option.HeaderInfo = s3s.CSVHeaderInfoNone
+	case string(s3s.CSVHeaderInfoUse):
+		option.HeaderInfo = s3s.CSVHeaderInfoUse
+	case string(s3s.CSVHeaderInfoIgnore):
+		option.HeaderInfo = s3s.CSVHeaderInfoIgnore
+	default:
+		return nil, errors.Errorf(`csv-header must be "none", "use" or "ignore"`)
+	}
+
+	option.FieldDelimiter = unescape(fieldDelimiter)
+	option.RecordDelimiter = unescape(recordDelimiter)
+	option.QuoteCharacter = unescape(quote)
+	option.Comments = unescape(comment)
+
+	for name, v := range map[string]string{
+		"csv-delimiter": option.FieldDelimiter,
+		"csv-quote":     option.QuoteCharacter,
+		"csv-comment":   option.Comments,
+	} {
+		if len([]rune(v)) > 1 {
+			return nil, errors.Errorf("%s must be a single character", name)
+		}
+	}
+
+	return option, nil
+}
+
+// unescape converts escape sequences such as "\t" typed in the shell.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`)
+	if err != nil {
+		return s
+	}
+	return unquoted
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koluku/s3s"
+)
+
+func TestBuildCSVOption(t *testing.T) {
+	cases := []struct {
+		name            string
+		header          string
+		fieldDelimiter  string
+		recordDelimiter string
+		quote           string
+		comment         string
+		want            *s3s.CSVOption
+		wantErr         bool
+	}{
+		{
+			name: "no option",
+			want: nil,
+		},
+		{
+			name:   "use header",
+			header: "use",
+			want:   &s3s.CSVOption{HeaderInfo: s3s.CSVHeaderInfoUse},
+		},
+		{
+			name:            "escaped delimiters",
+			fieldDelimiter:  `\t`,
+			recordDelimiter: `\r\n`,
+			quote:           `'`,
+			comment:         `#`,
+			want: &s3s.CSVOption{
+				FieldDelimiter:  "\t",
+				RecordDelimiter: "\r\n",
+				QuoteCharacter:  "'",
+				Comments:        "#",
+			},
+		},
+		{
+			name:    "unknown header",
+			header:  "skip",
+			wantErr: true,
+		},
+		{
+			name:           "too long delimiter",
+			fieldDelimiter: "||",
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := buildCSVOption(tt.header, tt.fieldDelimiter, tt.recordDelimiter, tt.quote, tt.comment)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %+v,\nbut got = %+v", tt.want, got)
+			}
+		})
+	}
+}
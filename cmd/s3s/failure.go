@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/koluku/s3s"
+)
+
+func printFailures(w io.Writer, failures []s3s.Failure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "failed file count: %s\n", humanize.Comma(int64(len(failures))))
+	for _, failure := range failures {
+		fmt.Fprintf(w, "s3://%s/%s [%s] %s\n", failure.Bucket, failure.Key, failure.Class, failure.Message)
+	}
+}
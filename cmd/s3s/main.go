@@ -23,21 +23,66 @@ var (
 	where    string
 	limit    int
 	isCount  bool
+	countBy  string
 
-	isCSV     bool
-	isALBLogs bool
-	isCFLogs  bool
+	isCSV              bool
+	csvHeader          string
+	csvFieldDelimiter  string
+	csvRecordDelimiter string
+	csvQuote           string
+	csvComment         string
+	isALBLogs          bool
+	isNLBLogs          bool
+	isCLBLogs          bool
+	isCFLogs           bool
+	isVPCFlowLogs      bool
+	isCloudTrail       bool
+	isS3AccessLogs     bool
+	isWAFLogs          bool
+	isParquet          bool
 
-	duration time.Duration
-	since    time.Time
-	cliSince cli.Timestamp
-	until    time.Time
-	cliUntil cli.Timestamp
+	duration          time.Duration
+	modifiedSlack     time.Duration
+	partitionTemplate string
+	since             time.Time
+	cliSince          cli.Timestamp
+	until             time.Time
+	cliUntil          cli.Timestamp
+
+	// AWS
+	region          string
+	profile         string
+	endpointURL     string
+	isPathStyle     bool
+	maxAttempts     int
+	selectRetries   int
+	threadCount     int
+	listThreadCount int
+	scanRangeSize   string
 
 	// command option
+	engine   string
 	isDelve  bool
 	isDebug  bool
 	isDryRun bool
+
+	isContinueOnError bool
+	isFailOnError     bool
+	maxCost           float64
+	isStats           bool
+	isProgress        bool
+	checkpointPath    string
+	isResume          bool
+	priceTable        string
+
+	// Key Filter
+	include      cli.StringSlice
+	exclude      cli.StringSlice
+	includeRegex cli.StringSlice
+	excludeRegex cli.StringSlice
+	minSize      string
+	maxSize      string
+	archive      string
 )
 
 func main() {
@@ -49,6 +94,70 @@ func main() {
 		Version: Version,
 		Usage:   "Easy S3 select like searching in directories",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Category:    "AWS:",
+				Name:        "region",
+				Usage:       "region of target s3 bucket exist",
+				EnvVars:     []string{"AWS_REGION"},
+				Destination: &region,
+			},
+			&cli.StringFlag{
+				Category:    "AWS:",
+				Name:        "profile",
+				Usage:       "profile of shared config and credentials",
+				EnvVars:     []string{"AWS_PROFILE"},
+				Destination: &profile,
+			},
+			&cli.StringFlag{
+				Category:    "AWS:",
+				Name:        "endpoint-url",
+				Aliases:     []string{"endpoint_url"},
+				Usage:       "custom endpoint url for S3-compatible storage",
+				Destination: &endpointURL,
+			},
+			&cli.BoolFlag{
+				Category:    "AWS:",
+				Name:        "path-style",
+				Aliases:     []string{"path_style"},
+				Usage:       "use path-style addressing of bucket",
+				Destination: &isPathStyle,
+			},
+			&cli.IntFlag{
+				Category:    "AWS:",
+				Name:        "max-attempts",
+				Aliases:     []string{"max-retries", "M"},
+				Usage:       "max attempts of each API request including the first one, 0 means the SDK default of 3",
+				Destination: &maxAttempts,
+			},
+			&cli.IntFlag{
+				Category:    "AWS:",
+				Name:        "select-retries",
+				Usage:       "max number of retries for each object failed with throttling or a transient error",
+				Value:       s3s.DEFAULT_SELECT_RETRIES,
+				Destination: &selectRetries,
+			},
+			&cli.IntFlag{
+				Category:    "AWS:",
+				Name:        "thread-count",
+				Aliases:     []string{"t"},
+				Usage:       "max number of s3 select requests to concurrently",
+				Value:       s3s.DEFAULT_THREAD_COUNT,
+				Destination: &threadCount,
+			},
+			&cli.IntFlag{
+				Category:    "AWS:",
+				Name:        "list-thread-count",
+				Usage:       "max number of prefixes to list concurrently",
+				Value:       s3s.DEFAULT_THREAD_COUNT,
+				Destination: &listThreadCount,
+			},
+			&cli.StringFlag{
+				Category:    "AWS:",
+				Name:        "scan-range-size",
+				Usage:       `split uncompressed JSON lines or CSV objects larger than this into ranges selected concurrently, "0" disables it`,
+				Value:       humanize.IBytes(s3s.DEFAULT_SCAN_RANGE_SIZE),
+				Destination: &scanRangeSize,
+			},
 			&cli.StringFlag{
 				Category:    "Query:",
 				Name:        "query",
@@ -67,43 +176,121 @@ func main() {
 				Category:    "Query:",
 				Name:        "limit",
 				Aliases:     []string{"l"},
-				Usage:       "max number of results from each key to return",
+				Usage:       "max number of results to return, and stop querying the rest of keys",
 				Destination: &limit,
 			},
 			&cli.BoolFlag{
 				Category:    "Query:",
 				Name:        "count",
 				Aliases:     []string{"c"},
-				Usage:       "max number of results from each key to return",
+				Usage:       "total number of results from all keys",
 				Destination: &isCount,
 			},
+			&cli.StringFlag{
+				Category:    "Query:",
+				Name:        "count-by",
+				Aliases:     []string{"count_by"},
+				Usage:       `breakdown of count by "key" or "prefix"`,
+				Destination: &countBy,
+			},
 			&cli.BoolFlag{
 				Category:    "Input Format:",
 				Name:        "csv",
 				Destination: &isCSV,
 			},
+			&cli.StringFlag{
+				Category:    "Input Format:",
+				Name:        "csv-header",
+				Usage:       `header line of csv, "none", "use" as column names or "ignore"`,
+				Destination: &csvHeader,
+			},
+			&cli.StringFlag{
+				Category:    "Input Format:",
+				Name:        "csv-delimiter",
+				Usage:       `field delimiter of csv (ex: "\t")`,
+				Destination: &csvFieldDelimiter,
+			},
+			&cli.StringFlag{
+				Category:    "Input Format:",
+				Name:        "csv-record-delimiter",
+				Usage:       `record delimiter of csv (ex: "\r\n")`,
+				Destination: &csvRecordDelimiter,
+			},
+			&cli.StringFlag{
+				Category:    "Input Format:",
+				Name:        "csv-quote",
+				Usage:       "quote character of csv",
+				Destination: &csvQuote,
+			},
+			&cli.StringFlag{
+				Category:    "Input Format:",
+				Name:        "csv-comment",
+				Usage:       "prefix of comment lines of csv",
+				Destination: &csvComment,
+			},
 			&cli.BoolFlag{
 				Category:    "Input Format:",
 				Name:        "alb-logs",
 				Aliases:     []string{"alb_logs"},
 				Destination: &isALBLogs,
 			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "nlb-logs",
+				Aliases:     []string{"nlb_logs"},
+				Destination: &isNLBLogs,
+			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "clb-logs",
+				Aliases:     []string{"clb_logs"},
+				Destination: &isCLBLogs,
+			},
 			&cli.BoolFlag{
 				Category:    "Input Format:",
 				Name:        "cf-logs",
 				Aliases:     []string{"cf_logs"},
 				Destination: &isCFLogs,
 			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "vpc-flow-logs",
+				Aliases:     []string{"vpc_flow_logs"},
+				Destination: &isVPCFlowLogs,
+			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "cloudtrail",
+				Usage:       "each event in Records of the json document is a record",
+				Destination: &isCloudTrail,
+			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "s3-access-logs",
+				Aliases:     []string{"s3_access_logs"},
+				Destination: &isS3AccessLogs,
+			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "waf-logs",
+				Aliases:     []string{"waf_logs"},
+				Destination: &isWAFLogs,
+			},
+			&cli.BoolFlag{
+				Category:    "Input Format:",
+				Name:        "parquet",
+				Destination: &isParquet,
+			},
 			&cli.DurationFlag{
 				Category:    "Time:",
 				Name:        "duration",
-				Usage:       `from current time if alb or cf (ex: "2h3m")`,
+				Usage:       `from current time (ex: "2h3m")`,
 				Destination: &duration,
 			},
 			&cli.TimestampFlag{
 				Category:    "Time:",
 				Name:        "since",
-				Usage:       `end at if alb or cf (ex: "2006-01-02 15:04:05")`,
+				Usage:       `start at (ex: "2006-01-02 15:04:05")`,
 				Layout:      "2006-01-02 15:04:05",
 				Timezone:    time.UTC,
 				Destination: &cliSince,
@@ -111,17 +298,80 @@ func main() {
 			&cli.TimestampFlag{
 				Category:    "Time:",
 				Name:        "until",
-				Usage:       `start at if alb or cf (ex: "2006-01-02 15:04:05")`,
+				Usage:       `end at (ex: "2006-01-02 15:04:05")`,
 				Layout:      "2006-01-02 15:04:05",
 				Timezone:    time.UTC,
 				Destination: &cliUntil,
 			},
+			&cli.DurationFlag{
+				Category:    "Time:",
+				Name:        "modified-slack",
+				Usage:       "keys are filtered by LastModified within since/until widened by this, unless prefixes are narrowed by the log format or partition-template, and negative disables it",
+				Value:       s3s.DEFAULT_LAST_MODIFIED_SLACK,
+				Destination: &modifiedSlack,
+			},
+			&cli.StringFlag{
+				Category:    "Time:",
+				Name:        "partition-template",
+				Usage:       `prefixes by the time range for any format (ex: "{prefix}/year={YYYY}/month={MM}/day={DD}/")`,
+				Destination: &partitionTemplate,
+			},
+			&cli.StringSliceFlag{
+				Category:    "Key Filter:",
+				Name:        "include",
+				Usage:       `glob of keys to select, matching the base name without "/" (ex: "*.json")`,
+				Destination: &include,
+			},
+			&cli.StringSliceFlag{
+				Category:    "Key Filter:",
+				Name:        "exclude",
+				Usage:       `glob of keys to skip, matching the base name without "/" (ex: "_SUCCESS")`,
+				Destination: &exclude,
+			},
+			&cli.StringSliceFlag{
+				Category:    "Key Filter:",
+				Name:        "include-regex",
+				Usage:       "regular expression of keys to select",
+				Destination: &includeRegex,
+			},
+			&cli.StringSliceFlag{
+				Category:    "Key Filter:",
+				Name:        "exclude-regex",
+				Usage:       "regular expression of keys to skip",
+				Destination: &excludeRegex,
+			},
+			&cli.StringFlag{
+				Category:    "Key Filter:",
+				Name:        "min-size",
+				Usage:       `skip keys smaller than this (ex: "1B")`,
+				Destination: &minSize,
+			},
+			&cli.StringFlag{
+				Category:    "Key Filter:",
+				Name:        "max-size",
+				Usage:       `skip keys larger than this (ex: "1GB")`,
+				Destination: &maxSize,
+			},
+			&cli.StringFlag{
+				Category:    "Key Filter:",
+				Name:        "archive",
+				Usage:       `"skip", "warn" or "fail" for objects in GLACIER or DEEP_ARCHIVE`,
+				Value:       ARCHIVE_WARN,
+				Destination: &archive,
+			},
 			&cli.BoolFlag{
 				Category:    "Run:",
 				Name:        "delve",
 				Usage:       "like directory move before querying",
 				Destination: &isDelve,
 			},
+			&cli.StringFlag{
+				Category:    "Run:",
+				Name:        "engine",
+				Usage:       `"auto", "s3select" or "local" which gets objects and queries them on local`,
+				Value:       ENGINE_AUTO,
+				Destination: &engine,
+			},
 			&cli.BoolFlag{
 				Category:    "Run:",
 				Name:        "dry-run",
@@ -129,6 +379,54 @@ func main() {
 				Usage:       "pre request for s3 select",
 				Destination: &isDryRun,
 			},
+			&cli.BoolFlag{
+				Category:    "Run:",
+				Name:        "continue-on-error",
+				Usage:       "continue other objects when an object fails, and report failures to stderr",
+				Destination: &isContinueOnError,
+			},
+			&cli.BoolFlag{
+				Category:    "Run:",
+				Name:        "fail-on-error",
+				Usage:       "exit with non-zero code when any object fails with --continue-on-error",
+				Destination: &isFailOnError,
+			},
+			&cli.StringFlag{
+				Category:    "Run:",
+				Name:        "checkpoint",
+				Usage:       "file to record each completed key, for resume option",
+				Destination: &checkpointPath,
+			},
+			&cli.BoolFlag{
+				Category:    "Run:",
+				Name:        "resume",
+				Usage:       "skip the keys completed in the checkpoint file, and append new ones to it",
+				Destination: &isResume,
+			},
+			&cli.BoolFlag{
+				Category:    "Run:",
+				Name:        "progress",
+				Usage:       "print the progress to stderr, only when stderr is a terminal",
+				Destination: &isProgress,
+			},
+			&cli.BoolFlag{
+				Category:    "Run:",
+				Name:        "stats",
+				Usage:       "print scanned, processed and returned bytes reported by S3 Select and the cost to stderr after a run",
+				Destination: &isStats,
+			},
+			&cli.Float64Flag{
+				Category:    "Run:",
+				Name:        "max-cost",
+				Usage:       "refuse to run the query when its estimated cost in USD is above it",
+				Destination: &maxCost,
+			},
+			&cli.StringFlag{
+				Category:    "Run:",
+				Name:        "price-table",
+				Usage:       `JSON file of prices for each region such as {"ap-northeast-1":{"scan_per_gb":0.00225,...}}`,
+				Destination: &priceTable,
+			},
 			&cli.BoolFlag{
 				Name:        "debug",
 				Usage:       "erorr check for developer",
@@ -165,20 +463,69 @@ func cmd(ctx context.Context, paths []string) error {
 	if err := checkArgs(paths); err != nil {
 		return errors.WithStack(err)
 	}
-	if isALBLogs || isCFLogs {
-		if err := checkTime(duration, until, since); err != nil {
-			return errors.WithStack(err)
-		}
+	if err := checkTime(duration, until, since); err != nil {
+		return errors.WithStack(err)
+	}
+	if partitionTemplate != "" && duration == 0 && since.IsZero() {
+		return errors.Errorf("partition-template option needs duration or since/until option")
 	}
-	if err := checkQuery(queryStr, where, limit, isCount); err != nil {
+	if err := checkQuery(queryStr, where, limit, isCount, countBy); err != nil {
 		return errors.WithStack(err)
 	}
-	if err := checkFileFormat(isCSV, isALBLogs, isCFLogs); err != nil {
+	if err := checkFileFormat(isCSV, isALBLogs, isNLBLogs, isCLBLogs, isCFLogs, isVPCFlowLogs, isCloudTrail, isS3AccessLogs, isWAFLogs, isParquet); err != nil {
 		return errors.WithStack(err)
 	}
+	csvOption, err := buildCSVOption(csvHeader, csvFieldDelimiter, csvRecordDelimiter, csvQuote, csvComment)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if csvOption != nil && !isCSV {
+		return errors.Errorf("csv options need --csv option")
+	}
+	engineType, err := parseEngine(engine)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	minSizeBytes, maxSizeBytes, err := parseSizeRange(minSize, maxSize)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	scanRangeBytes, err := humanize.ParseBytes(scanRangeSize)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	archivePolicy, err := parseArchivePolicy(archive)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if selectRetries < 0 {
+		return errors.Errorf("minus select-retries error")
+	}
+	if maxCost < 0 {
+		return errors.Errorf("minus max-cost error")
+	}
+	if isResume && checkpointPath == "" {
+		return errors.Errorf("resume option needs checkpoint option")
+	}
+	if checkpointPath != "" && isCount {
+		return errors.Errorf("can't use checkpoint option with count option")
+	}
+	if isFailOnError && !isContinueOnError {
+		return errors.Errorf("fail-on-error option needs continue-on-error option")
+	}
 
 	// Initialize
-	app, err := s3s.New(ctx)
+	app, err := s3s.New(ctx,
+		s3s.WithRegion(region),
+		s3s.WithProfile(profile),
+		s3s.WithEndpoint(endpointURL),
+		s3s.WithPathStyle(isPathStyle),
+		s3s.WithMaxAttempts(maxAttempts),
+		s3s.WithSelectRetries(selectRetries),
+		s3s.WithListConcurrency(listThreadCount),
+		s3s.WithSelectConcurrency(threadCount),
+		s3s.WithScanRangeSize(int64(scanRangeBytes)),
+	)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -193,7 +540,24 @@ func cmd(ctx context.Context, paths []string) error {
 
 	// Execution
 	if queryStr == "" {
-		queryStr = buildQuery(where, limit, isCount, isALBLogs, isCFLogs)
+		var whereMap map[string]string
+		switch {
+		case isALBLogs:
+			whereMap = albLogsWhereMap
+		case isNLBLogs:
+			whereMap = nlbLogsWhereMap
+		case isCLBLogs:
+			whereMap = clbLogsWhereMap
+		case isCFLogs:
+			whereMap = cfLogsWhereMap
+		case isVPCFlowLogs:
+			whereMap = vpcFlowLogsWhereMap
+		case isS3AccessLogs:
+			whereMap = s3AccessLogsWhereMap
+		case isWAFLogs:
+			whereMap = wafLogsWhereMap
+		}
+		queryStr = buildQuery(where, limit, isCount, whereMap)
 	}
 
 	var query *s3s.Query
@@ -202,30 +566,52 @@ func cmd(ctx context.Context, paths []string) error {
 		query = &s3s.Query{
 			FormatType: s3s.FormatTypeCSV,
 			Query:      queryStr,
+			CSV:        csvOption,
+		}
+	case isParquet:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeParquet,
+			Query:      queryStr,
 		}
 	case isALBLogs:
 		query = &s3s.Query{
 			FormatType: s3s.FormatTypeALBLogs,
 			Query:      queryStr,
 		}
-		if duration > 0 {
-			query.Since = time.Now().UTC().Add(-duration)
-			query.Until = time.Now().UTC()
-		} else {
-			query.Since = since
-			query.Until = until
+	case isNLBLogs:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeNLBLogs,
+			Query:      queryStr,
+		}
+	case isCLBLogs:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeCLBLogs,
+			Query:      queryStr,
 		}
 	case isCFLogs:
 		query = &s3s.Query{
 			FormatType: s3s.FormatTypeCFLogs,
 			Query:      queryStr,
 		}
-		if duration > 0 {
-			query.Since = time.Now().UTC().Add(-duration)
-			query.Until = time.Now().UTC()
-		} else {
-			query.Since = since
-			query.Until = until
+	case isVPCFlowLogs:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeVPCFlowLogs,
+			Query:      queryStr,
+		}
+	case isCloudTrail:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeCloudTrail,
+			Query:      queryStr,
+		}
+	case isS3AccessLogs:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeS3AccessLogs,
+			Query:      queryStr,
+		}
+	case isWAFLogs:
+		query = &s3s.Query{
+			FormatType: s3s.FormatTypeWAFLogs,
+			Query:      queryStr,
 		}
 	default:
 		query = &s3s.Query{
@@ -233,12 +619,51 @@ func cmd(ctx context.Context, paths []string) error {
 			Query:      queryStr,
 		}
 	}
+	query.PartitionTemplate = partitionTemplate
+	query.LastModifiedSlack = modifiedSlack
+	setTimeRange(query)
+	query.Include = include.Value()
+	query.Exclude = exclude.Value()
+	query.IncludeRegex = includeRegex.Value()
+	query.ExcludeRegex = excludeRegex.Value()
+	query.MinSize = minSizeBytes
+	query.MaxSize = maxSizeBytes
+
 	option := &s3s.Option{
 		IsDryRun:    isDryRun,
 		IsCountMode: isCount,
+		EngineType:  engineType,
+		Limit:       limit,
+
+		ErrOutput:       os.Stderr,
+		ArchivePolicy:   archivePolicy,
+		ContinueOnError: isContinueOnError,
+		MaxCost:         maxCost,
+	}
+	if isDryRun || isStats || maxCost > 0 {
+		price, err := loadPrice(priceTable, app.Region())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		option.Price = &price
+	}
+
+	if checkpointPath != "" {
+		checkpoint, closer, err := openCheckpoint(checkpointPath, isResume)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer closer.Close()
+		option.Checkpoint = checkpoint
+	}
+	if isProgress && !isDryRun {
+		option.OnProgress = newProgressPrinter()
 	}
 
 	result, err := app.Run(ctx, paths, query, option)
+	if option.OnProgress != nil {
+		endProgress()
+	}
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -247,12 +672,39 @@ func cmd(ctx context.Context, paths []string) error {
 	if isDryRun {
 		fmt.Printf("file count: %s\n", humanize.Comma(int64(result.Count)))
 		fmt.Printf("all scan byte: %s\n", humanize.Bytes(uint64(result.Bytes)))
+		fmt.Printf("skipped file count: %s\n", humanize.Comma(int64(result.SkippedCount)))
+		fmt.Printf("skipped byte: %s\n", humanize.Bytes(uint64(result.SkippedBytes)))
+		printStorageClasses(result.StorageClasses)
+		printCost(s3s.EstimateCost(result, *option.Price))
+	}
+	if isCount && !isDryRun {
+		printCount(result, countBy)
 	}
 	if isDelve {
 		for _, path := range paths {
 			fmt.Fprintln(os.Stderr, path)
 		}
 	}
+	if isStats && !isDryRun {
+		printStats(os.Stderr, result, *option.Price)
+	}
+	if result.ResumedCount > 0 {
+		fmt.Fprintf(os.Stderr, "resumed file count: %s\n", humanize.Comma(int64(result.ResumedCount)))
+	}
+	printFailures(os.Stderr, result.Failures)
+	if isFailOnError && len(result.Failures) > 0 {
+		return errors.Errorf("%d objects failed", len(result.Failures))
+	}
 
 	return nil
 }
+
+func setTimeRange(query *s3s.Query) {
+	if duration > 0 {
+		query.Since = time.Now().UTC().Add(-duration)
+		query.Until = time.Now().UTC()
+	} else {
+		query.Since = since
+		query.Until = until
+	}
+}
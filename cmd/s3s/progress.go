@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/koluku/s3s"
+	"golang.org/x/term"
+)
+
+// newProgressPrinter returns nil when stderr is not a terminal, such as redirected to a file.
+func newProgressPrinter() func(s3s.Progress) {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return func(p s3s.Progress) {
+		// \r and \033[K rewrite the line in place.
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", formatProgress(p))
+	}
+}
+
+func formatProgress(p s3s.Progress) string {
+	listed := humanize.Comma(int64(p.KeysListed))
+	if !p.IsListed {
+		listed += "+"
+	}
+	eta := "-"
+	if d := p.ETA(); d > 0 {
+		eta = d.Round(time.Second).String()
+	}
+	return fmt.Sprintf("keys: %s/%s, in-flight: %d, records: %s, scanned: %s (%s/s), eta: %s",
+		humanize.Comma(int64(p.KeysSelected)),
+		listed,
+		p.InFlight,
+		humanize.Comma(int64(p.Records)),
+		humanize.Bytes(uint64(p.BytesScanned)),
+		humanize.Bytes(uint64(p.Throughput())),
+		eta,
+	)
+}
+
+// endProgress moves to the next line after the last progress.
+func endProgress() {
+	fmt.Fprintln(os.Stderr)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koluku/s3s"
+)
+
+func TestFormatProgress(t *testing.T) {
+	cases := []struct {
+		name     string
+		progress s3s.Progress
+		want     string
+	}{
+		{
+			name:     "listing",
+			progress: s3s.Progress{KeysListed: 1200, KeysSelected: 300, InFlight: 150, Records: 42, BytesScanned: 10_000_000, Elapsed: 10 * time.Second},
+			want:     "keys: 300/1,200+, in-flight: 150, records: 42, scanned: 10 MB (1.0 MB/s), eta: -",
+		},
+		{
+			name:     "listed",
+			progress: s3s.Progress{KeysListed: 1200, IsListed: true, KeysSelected: 300, Elapsed: 10 * time.Second},
+			want:     "keys: 300/1,200, in-flight: 0, records: 0, scanned: 0 B (0 B/s), eta: 30s",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := formatProgress(tt.progress); got != tt.want {
+				t.Errorf("want = %s, but got = %s", tt.want, got)
+			}
+		})
+	}
+}
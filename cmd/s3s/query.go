@@ -3,12 +3,21 @@ package main
 import (
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 const (
 	DEFAULT_QUERY = "SELECT * FROM S3Object s"
 )
 
+// s3AccessLogsTime converts [06/Feb/2019:00:00:38 of _3 into 2019-02-06T00:00:38Z, which sorts as a string.
+// The offset in _4 is ignored, because S3 access logs are always in UTC.
+const s3AccessLogsTime = "(SUBSTRING(s._3, 9, 4) || '-' || CASE SUBSTRING(s._3, 5, 3)" +
+	" WHEN 'Jan' THEN '01' WHEN 'Feb' THEN '02' WHEN 'Mar' THEN '03' WHEN 'Apr' THEN '04'" +
+	" WHEN 'May' THEN '05' WHEN 'Jun' THEN '06' WHEN 'Jul' THEN '07' WHEN 'Aug' THEN '08'" +
+	" WHEN 'Sep' THEN '09' WHEN 'Oct' THEN '10' WHEN 'Nov' THEN '11' WHEN 'Dec' THEN '12' END" +
+	" || '-' || SUBSTRING(s._3, 2, 2) || 'T' || SUBSTRING(s._3, 14, 8) || 'Z')"
+
 var (
 	albLogsWhereMap = map[string]string{
 		"type":                     "_1",
@@ -41,6 +50,47 @@ var (
 		"classification":           "_28",
 		"classification_reason":    "_29",
 	}
+	nlbLogsWhereMap = map[string]string{
+		"type":                         "_1",
+		"version":                      "_2",
+		"time":                         "_3",
+		"elb":                          "_4",
+		"listener":                     "_5",
+		"client:port":                  "_6",
+		"destination:port":             "_7",
+		"connection_time":              "_8",
+		"tls_handshake_time":           "_9",
+		"received_bytes":               "_10",
+		"sent_bytes":                   "_11",
+		"incoming_tls_alert":           "_12",
+		"chosen_cert_arn":              "_13",
+		"chosen_cert_serial":           "_14",
+		"tls_cipher":                   "_15",
+		"tls_protocol_version":         "_16",
+		"tls_named_group":              "_17",
+		"domain_name":                  "_18",
+		"alpn_fe_protocol":             "_19",
+		"alpn_be_protocol":             "_20",
+		"alpn_client_preference_list":  "_21",
+		"tls_connection_creation_time": "_22",
+	}
+	clbLogsWhereMap = map[string]string{
+		"time":                     "_1",
+		"elb":                      "_2",
+		"client:port":              "_3",
+		"backend:port":             "_4",
+		"request_processing_time":  "_5",
+		"backend_processing_time":  "_6",
+		"response_processing_time": "_7",
+		"elb_status_code":          "_8",
+		"backend_status_code":      "_9",
+		"received_bytes":           "_10",
+		"sent_bytes":               "_11",
+		"request":                  "_12",
+		"user_agent":               "_13",
+		"ssl_cipher":               "_14",
+		"ssl_protocol":             "_15",
+	}
 	cfLogsWhereMap = map[string]string{
 		"date":                        "_1",
 		"time":                        "_2",
@@ -76,9 +126,90 @@ var (
 		"sc-range-start":              "_32",
 		"sc-range-end":                "_33",
 	}
+	// s3AccessLogsWhereMap has time as s3AccessLogsTime, because the time such as [06/Feb/2019:00:00:38 +0000]
+	// is split by the space into _3 and _4, which don't sort.
+	s3AccessLogsWhereMap = map[string]string{
+		"bucket_owner":        "_1",
+		"bucket":              "_2",
+		"time":                s3AccessLogsTime,
+		"remote_ip":           "_5",
+		"requester":           "_6",
+		"request_id":          "_7",
+		"operation":           "_8",
+		"key":                 "_9",
+		"request_uri":         "_10",
+		"http_status":         "_11",
+		"error_code":          "_12",
+		"bytes_sent":          "_13",
+		"object_size":         "_14",
+		"total_time":          "_15",
+		"turn_around_time":    "_16",
+		"referer":             "_17",
+		"user_agent":          "_18",
+		"version_id":          "_19",
+		"host_id":             "_20",
+		"signature_version":   "_21",
+		"cipher_suite":        "_22",
+		"authentication_type": "_23",
+		"host_header":         "_24",
+		"tls_version":         "_25",
+		"access_point_arn":    "_26",
+		"acl_required":        "_27",
+	}
+	// wafLogsWhereMap has aliases for nested paths of WAF logs.
+	wafLogsWhereMap = map[string]string{
+		"timestamp":           "timestamp",
+		"action":              "action",
+		"webaclId":            "webaclId",
+		"terminatingRuleId":   "terminatingRuleId",
+		"terminatingRuleType": "terminatingRuleType",
+		"httpSourceName":      "httpSourceName",
+		"httpSourceId":        "httpSourceId",
+		"responseCodeSent":    "responseCodeSent",
+		"clientIp":            "httpRequest.clientIp",
+		"country":             "httpRequest.country",
+		"uri":                 "httpRequest.uri",
+		"args":                "httpRequest.args",
+		"httpVersion":         "httpRequest.httpVersion",
+		"httpMethod":          "httpRequest.httpMethod",
+		"requestId":           "httpRequest.requestId",
+	}
+	// vpcFlowLogsWhereMap quotes the field names because the header line names the columns.
+	vpcFlowLogsWhereMap = map[string]string{
+		"version":             `"version"`,
+		"account-id":          `"account-id"`,
+		"interface-id":        `"interface-id"`,
+		"srcaddr":             `"srcaddr"`,
+		"dstaddr":             `"dstaddr"`,
+		"srcport":             `"srcport"`,
+		"dstport":             `"dstport"`,
+		"protocol":            `"protocol"`,
+		"packets":             `"packets"`,
+		"bytes":               `"bytes"`,
+		"start":               `"start"`,
+		"end":                 `"end"`,
+		"action":              `"action"`,
+		"log-status":          `"log-status"`,
+		"vpc-id":              `"vpc-id"`,
+		"subnet-id":           `"subnet-id"`,
+		"instance-id":         `"instance-id"`,
+		"tcp-flags":           `"tcp-flags"`,
+		"type":                `"type"`,
+		"pkt-srcaddr":         `"pkt-srcaddr"`,
+		"pkt-dstaddr":         `"pkt-dstaddr"`,
+		"region":              `"region"`,
+		"az-id":               `"az-id"`,
+		"sublocation-type":    `"sublocation-type"`,
+		"sublocation-id":      `"sublocation-id"`,
+		"pkt-src-aws-service": `"pkt-src-aws-service"`,
+		"pkt-dst-aws-service": `"pkt-dst-aws-service"`,
+		"flow-direction":      `"flow-direction"`,
+		"traffic-path":        `"traffic-path"`,
+	}
 )
 
-func buildQuery(where string, limit int, isCount bool, isALBLogs bool, isCFLogs bool) string {
+// buildQuery replaces the column names in where with whereMap.
+func buildQuery(where string, limit int, isCount bool, whereMap map[string]string) string {
 	if where == "" && limit == 0 && !isCount {
 		return DEFAULT_QUERY
 	}
@@ -97,16 +228,14 @@ func buildQuery(where string, limit int, isCount bool, isALBLogs bool, isCFLogs
 		query += " LIMIT " + strconv.Itoa(limit)
 	}
 
-	if isALBLogs {
-		for k, v := range albLogsWhereMap {
-			rep := regexp.MustCompile(` (s\.)?` + "`?" + k + "`" + `? `)
-			query = rep.ReplaceAllString(query, " s."+v+" ")
-		}
-	} else if isCFLogs {
-		for k, v := range cfLogsWhereMap {
-			rep := regexp.MustCompile(` (s\.)?` + "`?" + k + "`" + `? `)
-			query = rep.ReplaceAllString(query, " s."+v+" ")
+	for k, v := range whereMap {
+		rep := regexp.MustCompile(` (s\.)?` + "`?" + regexp.QuoteMeta(k) + "`" + `? `)
+		// an expression in parentheses such as s3AccessLogsTime is not a column.
+		if strings.HasPrefix(v, "(") {
+			query = rep.ReplaceAllLiteralString(query, " "+v+" ")
+			continue
 		}
+		query = rep.ReplaceAllString(query, " s."+v+" ")
 	}
 
 	return query
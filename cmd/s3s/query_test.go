@@ -1,124 +1,160 @@
 package main
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/koluku/s3s/internal/s3sql"
+)
 
 func TestBuildQuery(t *testing.T) {
 	cases := []struct {
-		name      string
-		where     string
-		limit     int
-		isCount   bool
-		isALBLogs bool
-		isCFLogs  bool
-		want      string
+		name     string
+		where    string
+		limit    int
+		isCount  bool
+		whereMap map[string]string
+		want     string
 	}{
 		{
-			name:      "default",
-			where:     "",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s",
-		},
-		{
-			name:      "where",
-			where:     "s.time > '2022-09-26 00:00:00'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s WHERE s.time > '2022-09-26 00:00:00'",
-		},
-		{
-			name:      "limit",
-			where:     "",
-			limit:     1,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s LIMIT 1",
-		},
-		{
-			name:      "count",
-			where:     "",
-			limit:     0,
-			isCount:   true,
-			isALBLogs: false,
-			isCFLogs:  false,
-			want:      "SELECT COUNT(*) FROM S3Object s",
-		},
-		{
-			name:      "where as alb-logs",
-			where:     "s.time > '2022-09-26 00:00:00'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: true,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
-		},
-		{
-			name:      "where as alb-logs without s.",
-			where:     "time > '2022-09-26 00:00:00'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: true,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
-		},
-		{
-			name:      "where as alb-logs using backquote",
-			where:     "s.`time` > '2022-09-26 00:00:00'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: true,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
-		},
-		{
-			name:      "where as alb-logs using backquote without s.",
-			where:     "`time` > '2022-09-26 00:00:00'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: true,
-			isCFLogs:  false,
-			want:      "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
-		},
-		{
-			name:      "where as cf-logs",
-			where:     "s.date > '2022-09-26'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  true,
-			want:      "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
-		},
-		{
-			name:      "where as cf-logs without s",
-			where:     "date > '2022-09-26'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  true,
-			want:      "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
-		},
-		{
-			name:      "where as cf-logs using backquote",
-			where:     "s.`date` > '2022-09-26'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  true,
-			want:      "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
-		},
-		{
-			name:      "where as cf-logs using backquote without s",
-			where:     "`date` > '2022-09-26'",
-			limit:     0,
-			isCount:   false,
-			isALBLogs: false,
-			isCFLogs:  true,
-			want:      "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
+			name:    "default",
+			where:   "",
+			limit:   0,
+			isCount: false,
+			want:    "SELECT * FROM S3Object s",
+		},
+		{
+			name:    "where",
+			where:   "s.time > '2022-09-26 00:00:00'",
+			limit:   0,
+			isCount: false,
+			want:    "SELECT * FROM S3Object s WHERE s.time > '2022-09-26 00:00:00'",
+		},
+		{
+			name:    "limit",
+			where:   "",
+			limit:   1,
+			isCount: false,
+			want:    "SELECT * FROM S3Object s LIMIT 1",
+		},
+		{
+			name:    "count",
+			where:   "",
+			limit:   0,
+			isCount: true,
+			want:    "SELECT COUNT(*) FROM S3Object s",
+		},
+		{
+			name:     "where as alb-logs",
+			where:    "s.time > '2022-09-26 00:00:00'",
+			limit:    0,
+			isCount:  false,
+			whereMap: albLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
+		},
+		{
+			name:     "where as alb-logs without s.",
+			where:    "time > '2022-09-26 00:00:00'",
+			limit:    0,
+			isCount:  false,
+			whereMap: albLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
+		},
+		{
+			name:     "where as alb-logs using backquote",
+			where:    "s.`time` > '2022-09-26 00:00:00'",
+			limit:    0,
+			isCount:  false,
+			whereMap: albLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
+		},
+		{
+			name:     "where as alb-logs using backquote without s.",
+			where:    "`time` > '2022-09-26 00:00:00'",
+			limit:    0,
+			isCount:  false,
+			whereMap: albLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._2 > '2022-09-26 00:00:00'",
+		},
+		{
+			name:     "where as cf-logs",
+			where:    "s.date > '2022-09-26'",
+			limit:    0,
+			isCount:  false,
+			whereMap: cfLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
+		},
+		{
+			name:     "where as cf-logs without s",
+			where:    "date > '2022-09-26'",
+			limit:    0,
+			isCount:  false,
+			whereMap: cfLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
+		},
+		{
+			name:     "where as cf-logs using backquote",
+			where:    "s.`date` > '2022-09-26'",
+			limit:    0,
+			isCount:  false,
+			whereMap: cfLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
+		},
+		{
+			name:     "where as cf-logs using backquote without s",
+			where:    "`date` > '2022-09-26'",
+			limit:    0,
+			isCount:  false,
+			whereMap: cfLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._1 > '2022-09-26'",
+		},
+		{
+			name:     "where as vpc-flow-logs",
+			where:    "account-id = '123456789012' AND s.action = 'REJECT'",
+			limit:    0,
+			isCount:  false,
+			whereMap: vpcFlowLogsWhereMap,
+			want:     `SELECT * FROM S3Object s WHERE s."account-id" = '123456789012' AND s."action" = 'REJECT'`,
+		},
+		{
+			name:     "where as nlb-logs",
+			where:    "tls_protocol_version = 'tlsv12'",
+			limit:    0,
+			isCount:  false,
+			whereMap: nlbLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._16 = 'tlsv12'",
+		},
+		{
+			name:     "where as clb-logs",
+			where:    "s.backend_status_code = '502'",
+			limit:    0,
+			isCount:  false,
+			whereMap: clbLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._9 = '502'",
+		},
+		{
+			name:     "where as waf-logs",
+			where:    "action = 'BLOCK' AND clientIp = '192.0.2.1' AND s.uri LIKE '/admin%'",
+			limit:    0,
+			isCount:  false,
+			whereMap: wafLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s.action = 'BLOCK' AND s.httpRequest.clientIp = '192.0.2.1' AND s.httpRequest.uri LIKE '/admin%'",
+		},
+		{
+			name:     "where as s3-access-logs",
+			where:    "http_status = '404' AND key LIKE 'images/%'",
+			limit:    0,
+			isCount:  false,
+			whereMap: s3AccessLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE s._11 = '404' AND s._9 LIKE 'images/%'",
+		},
+		{
+			name:     "where as s3-access-logs with the time",
+			where:    "time >= '2019-02-06T00:00:39Z'",
+			limit:    0,
+			isCount:  false,
+			whereMap: s3AccessLogsWhereMap,
+			want:     "SELECT * FROM S3Object s WHERE " + s3AccessLogsTime + " >= '2019-02-06T00:00:39Z'",
 		},
 	}
 
@@ -126,10 +162,59 @@ func TestBuildQuery(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got := buildQuery(tt.where, tt.limit, tt.isCount, tt.isALBLogs, tt.isCFLogs)
+			got := buildQuery(tt.where, tt.limit, tt.isCount, tt.whereMap)
 			if got != tt.want {
 				t.Errorf("want = %s,\nbut got = %s", tt.want, got)
 			}
 		})
 	}
 }
+
+func TestS3AccessLogsTime(t *testing.T) {
+	input := strings.Join([]string{
+		`79a59df900b949e5 awsexamplebucket1 [31/Jan/2019:23:59:59 +0000] 192.0.2.3 79a59df900b949e5 3E57427F3EXAMPLE REST.GET.OBJECT a.html "GET /awsexamplebucket1/a.html HTTP/1.1" 200 - 113 113 7 6 "-" "S3Console/0.4" -`,
+		`79a59df900b949e5 awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 79a59df900b949e5 3E57427F3EXAMPLF REST.GET.OBJECT b.html "GET /awsexamplebucket1/b.html HTTP/1.1" 200 - 113 113 7 6 "-" "S3Console/0.4" -`,
+		`79a59df900b949e5 awsexamplebucket1 [06/Feb/2019:00:00:39 +0000] 192.0.2.3 79a59df900b949e5 3E57427F3EXAMPLG REST.GET.OBJECT c.html "GET /awsexamplebucket1/c.html HTTP/1.1" 200 - 113 113 7 6 "-" "S3Console/0.4" -`,
+	}, "\n")
+
+	cases := []struct {
+		name  string
+		where string
+		want  []string
+	}{
+		{
+			name:  "since",
+			where: "time >= '2019-02-06T00:00:38Z'",
+			want:  []string{`{"_9":"b.html"}`, `{"_9":"c.html"}`},
+		},
+		{
+			name:  "across months",
+			where: "time BETWEEN '2019-01-31T00:00:00Z' AND '2019-02-06T00:00:38Z'",
+			want:  []string{`{"_9":"a.html"}`, `{"_9":"b.html"}`},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			query := strings.Replace(buildQuery(tt.where, 0, false, s3AccessLogsWhereMap), "SELECT *", "SELECT s._9", 1)
+			st, err := s3sql.Parse(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			reader := s3sql.NewCSVReader(strings.NewReader(input), s3sql.CSVConfig{FieldDelimiter: ' ', Quote: '"', Comment: '#'})
+			if err := st.Exec(reader, func(b []byte) error {
+				got = append(got, string(b))
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/koluku/s3s"
+)
+
+func printStats(w io.Writer, result *s3s.Result, price s3s.Price) {
+	fmt.Fprintf(w, "selected file count: %s\n", humanize.Comma(int64(result.Objects)))
+	fmt.Fprintf(w, "record count: %s\n", humanize.Comma(int64(result.Records)))
+	fmt.Fprintf(w, "scanned byte: %s\n", humanize.Bytes(uint64(result.BytesScanned)))
+	fmt.Fprintf(w, "processed byte: %s\n", humanize.Bytes(uint64(result.BytesProcessed)))
+	fmt.Fprintf(w, "returned byte: %s\n", humanize.Bytes(uint64(result.BytesReturned)))
+	fmt.Fprintf(w, "list request count: %s\n", humanize.Comma(int64(result.ListRequests)))
+	fmt.Fprintf(w, "select request count: %s\n", humanize.Comma(int64(result.SelectRequests)))
+	fmt.Fprintf(w, "cost: $%.4f\n", s3s.ActualCost(result, price).Total())
+}
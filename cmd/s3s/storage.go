@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/koluku/s3s"
+)
+
+func printStorageClasses(storageClasses map[string]s3s.StorageClassTotal) {
+	classes := make([]string, 0, len(storageClasses))
+	for class := range storageClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	for _, class := range classes {
+		total := storageClasses[class]
+		fmt.Printf("%s: %s files, %s\n", class, humanize.Comma(int64(total.Count)), humanize.Bytes(uint64(total.Bytes)))
+	}
+}
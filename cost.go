@@ -0,0 +1,135 @@
+package s3s
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const DEFAULT_PRICE_REGION = "us-east-1"
+
+// Price is in USD.
+type Price struct {
+	ScanPerGB     float64 `json:"scan_per_gb"`
+	ReturnPerGB   float64 `json:"return_per_gb"`
+	ListPer1000   float64 `json:"list_per_1000"`
+	SelectPer1000 float64 `json:"select_per_1000"`
+}
+
+// PriceTable is the Price of each region.
+type PriceTable map[string]Price
+
+// DefaultPriceTable is the price of S3 Standard, and can be overridden by users for other regions or a discount.
+var DefaultPriceTable = PriceTable{
+	"us-east-1": {ScanPerGB: 0.002, ReturnPerGB: 0.0007, ListPer1000: 0.005, SelectPer1000: 0.0004},
+	"us-east-2": {ScanPerGB: 0.002, ReturnPerGB: 0.0007, ListPer1000: 0.005, SelectPer1000: 0.0004},
+	"us-west-2": {ScanPerGB: 0.002, ReturnPerGB: 0.0007, ListPer1000: 0.005, SelectPer1000: 0.0004},
+}
+
+// Lookup returns the price of the region, or of DEFAULT_PRICE_REGION with false when the region is unknown.
+func (t PriceTable) Lookup(region string) (Price, bool) {
+	if price, ok := t[region]; ok {
+		return price, true
+	}
+	return t[DEFAULT_PRICE_REGION], false
+}
+
+// Cost is in USD.
+type Cost struct {
+	Scan   float64
+	Return float64
+	List   float64
+	Select float64
+}
+
+func (c Cost) Total() float64 {
+	return c.Scan + c.Return + c.List + c.Select
+}
+
+// EstimateCost estimates the cost of the query from the result of a dry run.
+// The returned data is unknown before running, so it is estimated by the scanned bytes as its upper bound.
+func EstimateCost(result *Result, price Price) Cost {
+	gb := float64(result.EstimatedBytes) / (1 << 30)
+	return Cost{
+		Scan:   gb * price.ScanPerGB,
+		Return: gb * price.ReturnPerGB,
+		List:   float64(result.ListRequests) / 1000 * price.ListPer1000,
+		Select: float64(result.EstimatedSelectRequests) / 1000 * price.SelectPer1000,
+	}
+}
+
+// ActualCost is the cost of the query from the statistics of a run.
+func ActualCost(result *Result, price Price) Cost {
+	return Cost{
+		Scan:   float64(result.BytesScanned) / (1 << 30) * price.ScanPerGB,
+		Return: float64(result.BytesReturned) / (1 << 30) * price.ReturnPerGB,
+		List:   float64(result.ListRequests) / 1000 * price.ListPer1000,
+		Select: float64(result.SelectRequests) / 1000 * price.SelectPer1000,
+	}
+}
+
+func (c *Client) price(option *Option) Price {
+	if option.Price != nil {
+		return *option.Price
+	}
+	price, _ := DefaultPriceTable.Lookup(c.region)
+	return price
+}
+
+// tally adds the object to the estimate of the cost.
+func (c *Client) tally(result *Result, object s3Object, query *Query) {
+	result.EstimatedBytes += object.Size
+	result.EstimatedSelectRequests += len(newS3SelectInput(object, query).split(object.Size, c.scanRangeSize))
+}
+
+// checkMaxCost returns an error when the estimated cost is over MaxCost.
+func (c *Client) checkMaxCost(result *Result, option *Option) error {
+	if option.MaxCost <= 0 {
+		return nil
+	}
+	if cost := EstimateCost(result, c.price(option)); cost.Total() > option.MaxCost {
+		return errors.Errorf("estimated cost $%.4f is over max cost $%.4f", cost.Total(), option.MaxCost)
+	}
+	return nil
+}
+
+// collectBucketKeys lists all keys before select, to check the cost.
+func (c *Client) collectBucketKeys(ctx context.Context, prefixes []string, filter *keyFilter) ([]s3Object, error) {
+	ch := make(chan s3Object, c.listConcurrency)
+	eg, egctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		if err := c.getBucketKeys(egctx, ch, prefixes, filter); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	})
+
+	var objects []s3Object
+	eg.Go(func() error {
+		for object := range ch {
+			objects = append(objects, object)
+		}
+		return nil
+	})
+
+	if err := eg.Wait(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return objects, nil
+}
+
+func sendObjects(ctx context.Context, in chan<- s3Object, objects []s3Object) error {
+	defer close(in)
+
+	for _, object := range objects {
+		select {
+		case in <- object:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
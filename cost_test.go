@@ -0,0 +1,139 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	price := Price{ScanPerGB: 0.002, ReturnPerGB: 0.0007, ListPer1000: 0.005, SelectPer1000: 0.0004}
+	cases := []struct {
+		name   string
+		result *Result
+		want   Cost
+	}{
+		{
+			name:   "empty",
+			result: &Result{},
+			want:   Cost{},
+		},
+		{
+			name:   "10 GiB",
+			result: &Result{EstimatedBytes: 10 << 30, ListRequests: 2000, EstimatedSelectRequests: 5000},
+			want:   Cost{Scan: 0.02, Return: 0.007, List: 0.01, Select: 0.002},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := EstimateCost(tt.result, price)
+			for _, v := range [][2]float64{{got.Scan, tt.want.Scan}, {got.Return, tt.want.Return}, {got.List, tt.want.List}, {got.Select, tt.want.Select}} {
+				if math.Abs(v[0]-v[1]) > 1e-9 {
+					t.Errorf("want = %+v, but got = %+v", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestActualCost(t *testing.T) {
+	price := Price{ScanPerGB: 0.002, ReturnPerGB: 0.0007, ListPer1000: 0.005, SelectPer1000: 0.0004}
+	result := &Result{Bytes: 100 << 30, BytesScanned: 10 << 30, BytesReturned: 1 << 30, ListRequests: 1000, SelectRequests: 1000}
+	want := Cost{Scan: 0.02, Return: 0.0007, List: 0.005, Select: 0.0004}
+	if got := ActualCost(result, price); math.Abs(got.Total()-want.Total()) > 1e-9 {
+		t.Errorf("want = %+v, but got = %+v", want, got)
+	}
+}
+
+func TestPriceTableLookup(t *testing.T) {
+	if _, ok := DefaultPriceTable.Lookup("us-west-2"); !ok {
+		t.Errorf("want us-west-2 in the table")
+	}
+	got, ok := DefaultPriceTable.Lookup("unknown")
+	if ok {
+		t.Errorf("want unknown region not in the table")
+	}
+	if got != DefaultPriceTable[DEFAULT_PRICE_REGION] {
+		t.Errorf("want = %+v, but got = %+v", DefaultPriceTable[DEFAULT_PRICE_REGION], got)
+	}
+}
+
+func TestRunMaxCost(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"a":1}` + "\n"),
+				"prefix/b.json": []byte(`{"a":2}` + "\n"),
+			},
+		},
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		result, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{IsDryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.ListRequests != 1 {
+			t.Errorf("want = %d, but got = %d", 1, result.ListRequests)
+		}
+		if result.EstimatedSelectRequests != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.EstimatedSelectRequests)
+		}
+	})
+
+	t.Run("dry run over", func(t *testing.T) {
+		t.Parallel()
+		option := &Option{IsDryRun: true, MaxCost: 0.01, Price: &Price{SelectPer1000: 10}}
+		if _, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/prefix"}, query, option); err == nil {
+			t.Errorf("want error, but got nil")
+		}
+	})
+
+	t.Run("over", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		option := &Option{Output: &buf, MaxCost: 0.01, Price: &Price{SelectPer1000: 10}}
+		if _, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/prefix"}, query, option); err == nil {
+			t.Errorf("want error, but got nil")
+		}
+		if buf.Len() != 0 {
+			t.Errorf("want no output, but got = %s", buf.String())
+		}
+	})
+
+	t.Run("under", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		option := &Option{Output: &buf, MaxCost: 0.01}
+		result, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/prefix"}, query, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.Count(buf.Bytes(), []byte("\n")); got != 2 {
+			t.Errorf("want = %d, but got = %d", 2, got)
+		}
+		// the estimate is kept apart from the totals of a dry run and the actual requests.
+		if result.Count != 0 || result.Bytes != 0 {
+			t.Errorf("want = 0 count and bytes, but got = %d and %d", result.Count, result.Bytes)
+		}
+		if result.EstimatedBytes != 16 {
+			t.Errorf("want = %d, but got = %d", 16, result.EstimatedBytes)
+		}
+		if result.EstimatedSelectRequests != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.EstimatedSelectRequests)
+		}
+		if result.SelectRequests != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.SelectRequests)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package s3s
+
+import (
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Failure is an object which failed to be selected when ContinueOnError.
+type Failure struct {
+	Bucket  string
+	Key     string
+	Class   string
+	Message string
+}
+
+type failureReport struct {
+	mu       sync.Mutex
+	failures []Failure
+}
+
+func (r *failureReport) add(bucket string, key string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, Failure{
+		Bucket:  bucket,
+		Key:     key,
+		Class:   errorClass(err),
+		Message: errors.Cause(err).Error(),
+	})
+}
+
+// sorted returns the failures in order of the bucket and the key.
+func (r *failureReport) sorted() []Failure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.Slice(r.failures, func(i, j int) bool {
+		if r.failures[i].Bucket != r.failures[j].Bucket {
+			return r.failures[i].Bucket < r.failures[j].Bucket
+		}
+		return r.failures[i].Key < r.failures[j].Key
+	})
+	return r.failures
+}
+
+// errorClass is the error code of the API, or the kind of the error on the client.
+func errorClass(err error) string {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return "InvalidJSON"
+	}
+	var flateErr flate.CorruptInputError
+	var bzip2Err bzip2.StructuralError
+	if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.As(err, &flateErr) || errors.As(err, &bzip2Err) {
+		return "DecompressionError"
+	}
+	if errors.Is(err, errIncompleteStream) {
+		return "IncompleteStream"
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return "UnexpectedEOF"
+	}
+
+	return "Unknown"
+}
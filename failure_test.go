@@ -0,0 +1,34 @@
+package s3s
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestErrorClass(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "api", err: errors.WithStack(&fakeAPIError{code: "NoSuchKey"}), want: "NoSuchKey"},
+		{name: "json", err: errors.WithStack(json.Unmarshal([]byte("{]"), &struct{}{})), want: "InvalidJSON"},
+		{name: "gzip", err: errors.WithStack(gzip.ErrHeader), want: "DecompressionError"},
+		{name: "eof", err: errors.WithStack(io.ErrUnexpectedEOF), want: "UnexpectedEOF"},
+		{name: "unknown", err: errors.New("unknown"), want: "Unknown"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := errorClass(tt.err); got != tt.want {
+				t.Errorf("want = %s, but got = %s", tt.want, got)
+			}
+		})
+	}
+}
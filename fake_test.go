@@ -0,0 +1,218 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// fakeS3 is an in-memory S3API. Objects are stored as bucket -> key -> body,
+// and SelectObjectContent returns the body as-is without evaluating the query,
+// or the lines which start in ScanRange.
+type fakeS3 struct {
+	objects map[string]map[string][]byte
+	// selectErr is returned from SelectObjectContent such as S3-compatible stores without S3 Select.
+	selectErr error
+	// keyErr is returned from SelectObjectContent of each key.
+	keyErr map[string]error
+	// streamErr is returned from the event stream of each key after its records.
+	streamErr map[string]error
+	// incomplete ends the event stream of each key without the End event nor an error, like a dropped connection.
+	incomplete map[string]bool
+	// streamErrTimes limits streamErr and incomplete of each key to the first calls if set, like a transient error.
+	streamErrTimes map[string]int
+	// onSelect is called at the start of SelectObjectContent to see the state between requests.
+	onSelect func(params *s3.SelectObjectContentInput)
+
+	mu    sync.Mutex
+	calls map[string]int
+	// lastModified is LastModified of each key, and unset keys have no LastModified.
+	lastModified map[string]time.Time
+	// storageClass is StorageClass of each key.
+	storageClass map[string]types.ObjectStorageClass
+}
+
+type fakeAPIError struct {
+	code string
+}
+
+func (e *fakeAPIError) Error() string {
+	return "api error " + e.code
+}
+
+func (e *fakeAPIError) ErrorCode() string {
+	return e.code
+}
+
+func (f *fakeS3) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	var names []string
+	for name := range f.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	output := &s3.ListBucketsOutput{}
+	for _, name := range names {
+		output.Buckets = append(output.Buckets, types.Bucket{Name: aws.String(name)})
+	}
+	return output, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	objects, ok := f.objects[aws.ToString(params.Bucket)]
+	if !ok {
+		return nil, errors.Errorf("NoSuchBucket: %s", aws.ToString(params.Bucket))
+	}
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+
+	var keys []string
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if params.MaxKeys > 0 && len(output.Contents) >= int(params.MaxKeys) {
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(common)})
+				}
+				continue
+			}
+		}
+		object := types.Object{
+			Key:  aws.String(key),
+			Size: int64(len(objects[key])),
+			ETag: aws.String(fmt.Sprintf(`"%x"`, md5.Sum(objects[key]))),
+		}
+		if t, ok := f.lastModified[key]; ok {
+			object.LastModified = aws.Time(t)
+		}
+		object.StorageClass = f.storageClass[key]
+		output.Contents = append(output.Contents, object)
+	}
+	output.KeyCount = int32(len(output.Contents))
+
+	return output, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[aws.ToString(params.Bucket)][aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.Errorf("NoSuchKey: %s", aws.ToString(params.Key))
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func (f *fakeS3) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (s3.SelectObjectContentEventStreamReader, error) {
+	if f.onSelect != nil {
+		f.onSelect(params)
+	}
+	if f.selectErr != nil {
+		return nil, f.selectErr
+	}
+	if err, ok := f.keyErr[aws.ToString(params.Key)]; ok {
+		return nil, err
+	}
+	body, ok := f.objects[aws.ToString(params.Bucket)][aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.Errorf("NoSuchKey: %s", aws.ToString(params.Key))
+	}
+
+	if r := params.ScanRange; r != nil {
+		body = scanRangeLines(body, r.Start, r.End)
+	}
+	size := int64(len(body))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[key]++
+	var err error
+	var isIncomplete bool
+	if times, ok := f.streamErrTimes[key]; !ok || f.calls[key] <= times {
+		err = f.streamErr[key]
+		isIncomplete = f.incomplete[key]
+	}
+
+	// a failed stream has no Stats and End events.
+	events := []types.SelectObjectContentEventStream{
+		&types.SelectObjectContentEventStreamMemberRecords{Value: types.RecordsEvent{Payload: body}},
+		&types.SelectObjectContentEventStreamMemberProgress{Value: types.ProgressEvent{Details: &types.Progress{BytesScanned: size, BytesProcessed: size, BytesReturned: size}}},
+	}
+	if err == nil && !isIncomplete {
+		events = append(events,
+			&types.SelectObjectContentEventStreamMemberStats{Value: types.StatsEvent{Details: &types.Stats{BytesScanned: size, BytesProcessed: size, BytesReturned: size}}},
+			&types.SelectObjectContentEventStreamMemberEnd{},
+		)
+	}
+	stream := newFakeStream(events...)
+	stream.err = err
+	return stream, nil
+}
+
+func scanRangeLines(body []byte, start int64, end int64) []byte {
+	var lines []byte
+	var offset int64
+	for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+		if start <= offset && offset <= end {
+			lines = append(lines, line...)
+		}
+		offset += int64(len(line))
+	}
+	return lines
+}
+
+type fakeStream struct {
+	events chan types.SelectObjectContentEventStream
+	err    error
+}
+
+func newFakeStream(events ...types.SelectObjectContentEventStream) *fakeStream {
+	ch := make(chan types.SelectObjectContentEventStream, len(events))
+	for _, event := range events {
+		ch <- event
+	}
+	close(ch)
+	return &fakeStream{events: ch}
+}
+
+func (s *fakeStream) Events() <-chan types.SelectObjectContentEventStream {
+	return s.events
+}
+
+func (s *fakeStream) Close() error {
+	return nil
+}
+
+func (s *fakeStream) Err() error {
+	return s.err
+}
@@ -0,0 +1,141 @@
+package s3sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Exec evaluates the statement over all records, and emits each result as a JSON object.
+// A Statement keeps the state of aggregate functions, so it is executed only once.
+func (st *Statement) Exec(reader RecordReader, emit func([]byte) error) error {
+	var aggs []*aggExpr
+	for _, column := range st.Columns {
+		aggs = append(aggs, collectAggs(column.Expr)...)
+	}
+
+	var count int
+	for {
+		if len(aggs) == 0 && st.Limit > 0 && count >= st.Limit {
+			return nil
+		}
+
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if st.Where != nil {
+			ok, err := st.Where.Eval(rec)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if ok != true {
+				continue
+			}
+		}
+
+		if len(aggs) > 0 {
+			for _, agg := range aggs {
+				if err := agg.accumulate(rec); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			continue
+		}
+
+		b, err := st.project(rec)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := emit(b); err != nil {
+			return errors.WithStack(err)
+		}
+		count++
+	}
+
+	if len(aggs) > 0 {
+		b, err := st.project(&Record{})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := emit(b); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (st *Statement) project(rec *Record) ([]byte, error) {
+	if st.Columns == nil {
+		return rec.MarshalJSON()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	var n int
+	for _, column := range st.Columns {
+		v, err := column.Expr.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		if v == Missing {
+			continue
+		}
+
+		if path, ok := column.Expr.(*pathExpr); ok && path.star {
+			// s.* expands the fields of the record.
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			b, err := marshalValue(obj)
+			if err != nil {
+				return nil, err
+			}
+			if b = bytes.TrimSuffix(bytes.TrimPrefix(b, []byte("{")), []byte("}")); len(b) == 0 {
+				continue
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(b)
+			n++
+			continue
+		}
+
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(column.Name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		b, err := marshalValue(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		n++
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func marshalValue(v interface{}) ([]byte, error) {
+	if t, ok := v.(time.Time); ok {
+		v = t.Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
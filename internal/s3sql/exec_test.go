@@ -0,0 +1,276 @@
+package s3sql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`{"time":1654848930,"type":"speak","user":{"name":"alice","age":20}}`,
+		`{"time":1654848969,"type":"sleep","user":{"name":"bob","age":31}}`,
+		`{"time":1654849000,"type":"speak","user":{"name":"carol"}}`,
+	}, "\n")
+
+	cases := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "select all",
+			query: "SELECT * FROM S3Object s",
+			want: []string{
+				`{"time":1654848930,"type":"speak","user":{"name":"alice","age":20}}`,
+				`{"time":1654848969,"type":"sleep","user":{"name":"bob","age":31}}`,
+				`{"time":1654849000,"type":"speak","user":{"name":"carol"}}`,
+			},
+		},
+		{
+			name:  "where and limit",
+			query: "SELECT * FROM S3Object s WHERE s.type = 'speak' LIMIT 1",
+			want: []string{
+				`{"time":1654848930,"type":"speak","user":{"name":"alice","age":20}}`,
+			},
+		},
+		{
+			name:  "projection skips missing",
+			query: "SELECT s.user.name, s.user.age AS age FROM S3Object s WHERE s.type = 'speak'",
+			want: []string{
+				`{"name":"alice","age":20}`,
+				`{"name":"carol"}`,
+			},
+		},
+		{
+			name:  "expression without alias",
+			query: "SELECT UPPER(s.user.name), s.time - 1654848930 FROM S3Object s WHERE s.user.age >= 30",
+			want: []string{
+				`{"_1":"BOB","_2":39}`,
+			},
+		},
+		{
+			name:  "like, in, between and is missing",
+			query: "SELECT s.user.name FROM S3Object s WHERE s.user.name LIKE '%o%' AND s.type IN ('speak', 'sleep') AND s.time BETWEEN 1654848960 AND 1654849000 AND s.user.age IS NOT MISSING",
+			want: []string{
+				`{"name":"bob"}`,
+			},
+		},
+		{
+			name:  "case",
+			query: "SELECT CASE s.type WHEN 'speak' THEN 'S' ELSE 'Z' END AS t, CASE WHEN s.user.age >= 30 THEN 'adult' WHEN s.user.age < 30 THEN 'young' END AS a FROM S3Object s",
+			want: []string{
+				`{"t":"S","a":"young"}`,
+				`{"t":"Z","a":"adult"}`,
+				`{"t":"S","a":null}`,
+			},
+		},
+		{
+			name:  "aggregate",
+			query: "SELECT COUNT(*), SUM(s.user.age), AVG(s.user.age), MIN(s.time), MAX(s.user.name) FROM S3Object s",
+			want: []string{
+				`{"_1":3,"_2":51,"_3":25.5,"_4":1654848930,"_5":"carol"}`,
+			},
+		},
+		{
+			name:  "aggregate no match",
+			query: "SELECT COUNT(*), SUM(s.user.age) FROM S3Object s WHERE s.type = 'eat'",
+			want: []string{
+				`{"_1":0,"_2":null}`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			st, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			err = st.Exec(NewJSONReader(strings.NewReader(input), st.FromPath), func(b []byte) error {
+				got = append(got, string(b))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExecJSONDocument(t *testing.T) {
+	input := `{"Records":[{"eventName":"GetObject"},{"eventName":"PutObject"}]}`
+
+	st, err := Parse("SELECT s.eventName FROM S3Object[*].Records[*] s WHERE s.eventName = 'PutObject'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = st.Exec(NewJSONReader(strings.NewReader(input), st.FromPath), func(b []byte) error {
+		got = append(got, string(b))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`{"eventName":"PutObject"}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestExecCSV(t *testing.T) {
+	input := strings.Join([]string{
+		`https 2022-09-28T12:34:56.000000Z app/my-alb 10.0.0.1:1234 10.0.1.1:80 0.001 0.002 0.000 200 200 100 2000 "GET https://example.com:443/ HTTP/1.1" "curl/7.79.1"`,
+		`https 2022-09-28T12:35:00.000000Z app/my-alb 10.0.0.2:1234 10.0.1.1:80 0.001 0.010 0.000 502 - 100 300 "GET https://example.com:443/api HTTP/1.1" "curl/7.79.1"`,
+	}, "\n")
+
+	cases := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "select all",
+			query: "SELECT * FROM S3Object s WHERE s._9 = '502'",
+			want: []string{
+				`{"_1":"https","_2":"2022-09-28T12:35:00.000000Z","_3":"app/my-alb","_4":"10.0.0.2:1234","_5":"10.0.1.1:80","_6":"0.001","_7":"0.010","_8":"0.000","_9":"502","_10":"-","_11":"100","_12":"300","_13":"GET https://example.com:443/api HTTP/1.1","_14":"curl/7.79.1"}`,
+			},
+		},
+		{
+			name:  "cast and sum",
+			query: "SELECT SUM(CAST(s._12 AS INT)), MAX(CAST(s._7 AS FLOAT)) FROM S3Object s",
+			want: []string{
+				`{"_1":2300,"_2":0.01}`,
+			},
+		},
+		{
+			name:  "timestamp comparison",
+			query: "SELECT s._13 FROM S3Object s WHERE TO_TIMESTAMP(s._2) < TO_TIMESTAMP('2022-09-28T12:35:00Z')",
+			want: []string{
+				`{"_13":"GET https://example.com:443/ HTTP/1.1"}`,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			st, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			err = st.Exec(NewCSVReader(strings.NewReader(input), CSVConfig{FieldDelimiter: ' '}), func(b []byte) error {
+				got = append(got, string(b))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	cases := []string{
+		"SELECT FROM S3Object s",
+		"SELECT * FROM table s",
+		"SELECT * FROM S3Object s WHERE",
+		"SELECT * FROM S3Object s WHERE s.a = 'unterminated",
+		"SELECT UNKNOWN(s.a) FROM S3Object s",
+		"SELECT * FROM S3Object s LIMIT x",
+	}
+
+	for _, query := range cases {
+		query := query
+		t.Run(query, func(t *testing.T) {
+			t.Parallel()
+			if _, err := Parse(query); err == nil {
+				t.Errorf("want error, but got nil")
+			}
+		})
+	}
+}
+
+func TestExecCSVConfig(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   CSVConfig
+		input string
+		query string
+		want  []string
+	}{
+		{
+			name:  "use header",
+			cfg:   CSVConfig{Header: HeaderUse},
+			input: "id,name,age\n1,alice,20\n2,\"bob, jr.\",31\n",
+			query: "SELECT * FROM S3Object s WHERE CAST(s.age AS INT) > 30",
+			want:  []string{`{"id":"2","name":"bob, jr.","age":"31"}`},
+		},
+		{
+			name:  "use header with projection",
+			cfg:   CSVConfig{Header: HeaderUse},
+			input: "id,name,age\n1,alice,20\n2,bob,31\n",
+			query: "SELECT s.name FROM S3Object s WHERE s.id = '1'",
+			want:  []string{`{"name":"alice"}`},
+		},
+		{
+			name:  "ignore header",
+			cfg:   CSVConfig{Header: HeaderIgnore},
+			input: "id,name\n1,alice\n",
+			query: "SELECT * FROM S3Object s",
+			want:  []string{`{"_1":"1","_2":"alice"}`},
+		},
+		{
+			name:  "custom delimiters, quote and comment",
+			cfg:   CSVConfig{FieldDelimiter: '|', RecordDelimiter: "\r\n", Quote: '\'', Comment: ';'},
+			input: "; exported at 2022-09-28\r\n1|'a|b'\r\n2|'it''s'\r\n",
+			query: "SELECT * FROM S3Object s",
+			want:  []string{`{"_1":"1","_2":"a|b"}`, `{"_1":"2","_2":"it's"}`},
+		},
+		{
+			name:  "quoted record delimiter",
+			cfg:   CSVConfig{},
+			input: "1,\"multi\nline\"\n2,single",
+			query: "SELECT s._2 FROM S3Object s",
+			want:  []string{`{"_2":"multi\nline"}`, `{"_2":"single"}`},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			st, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			err = st.Exec(NewCSVReader(strings.NewReader(tt.input), tt.cfg), func(b []byte) error {
+				got = append(got, string(b))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,793 @@
+package s3sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type missing struct{}
+
+// Missing is the value of a path that does not exist in a record.
+var Missing = missing{}
+
+// Expr is an expression evaluated against a record.
+type Expr interface {
+	Eval(rec *Record) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e *literalExpr) Eval(rec *Record) (interface{}, error) {
+	return e.value, nil
+}
+
+type pathExpr struct {
+	names []string
+	star  bool
+}
+
+func (e *pathExpr) Eval(rec *Record) (interface{}, error) {
+	return rec.Get(e.names), nil
+}
+
+type logicalExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e *logicalExpr) Eval(rec *Record) (interface{}, error) {
+	l, err := e.left.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	lb, lok := l.(bool)
+	if e.op == "AND" && lok && !lb {
+		return false, nil
+	}
+	if e.op == "OR" && lok && lb {
+		return true, nil
+	}
+
+	r, err := e.right.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	rb, rok := r.(bool)
+	switch e.op {
+	case "AND":
+		if rok && !rb {
+			return false, nil
+		}
+		if lok && rok {
+			return true, nil
+		}
+	case "OR":
+		if rok && rb {
+			return true, nil
+		}
+		if lok && rok {
+			return false, nil
+		}
+	}
+	return nil, nil
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (e *notExpr) Eval(rec *Record) (interface{}, error) {
+	v, err := e.expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := v.(bool); ok {
+		return !b, nil
+	}
+	return nil, nil
+}
+
+type compareExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e *compareExpr) Eval(rec *Record) (interface{}, error) {
+	l, err := e.left.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.right.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := compare(l, r)
+	if !ok {
+		return nil, nil
+	}
+	switch e.op {
+	case "=":
+		return c == 0, nil
+	case "!=", "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+type isExpr struct {
+	expr    Expr
+	missing bool
+	not     bool
+}
+
+func (e *isExpr) Eval(rec *Record) (interface{}, error) {
+	v, err := e.expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	var is bool
+	if e.missing {
+		is = v == Missing
+	} else {
+		is = v == nil || v == Missing
+	}
+	return is != e.not, nil
+}
+
+type likeExpr struct {
+	expr, pattern, escape Expr
+	not                   bool
+	cache                 map[string]*regexp.Regexp
+}
+
+func (e *likeExpr) Eval(rec *Record) (interface{}, error) {
+	v, err := e.expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	p, err := e.pattern.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	s, sok := v.(string)
+	pattern, pok := p.(string)
+	if !sok || !pok {
+		return nil, nil
+	}
+	var escape string
+	if e.escape != nil {
+		esc, err := e.escape.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		escape, _ = esc.(string)
+	}
+
+	key := escape + "\x00" + pattern
+	rep, ok := e.cache[key]
+	if !ok {
+		rep, err = likeToRegexp(pattern, escape)
+		if err != nil {
+			return nil, err
+		}
+		if e.cache == nil {
+			e.cache = map[string]*regexp.Regexp{}
+		}
+		e.cache[key] = rep
+	}
+	return rep.MatchString(s) != e.not, nil
+}
+
+func likeToRegexp(pattern string, escape string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	rs := []rune(pattern)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case escape != "" && string(r) == escape && i+1 < len(rs):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(rs[i])))
+		case r == '%':
+			sb.WriteString(".*")
+		case r == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	rep, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rep, nil
+}
+
+type inExpr struct {
+	expr Expr
+	list []Expr
+	not  bool
+}
+
+func (e *inExpr) Eval(rec *Record) (interface{}, error) {
+	v, err := e.expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range e.list {
+		iv, err := item.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := compare(v, iv); ok && c == 0 {
+			return !e.not, nil
+		}
+	}
+	return e.not, nil
+}
+
+type betweenExpr struct {
+	expr, lower, upper Expr
+	not                bool
+}
+
+func (e *betweenExpr) Eval(rec *Record) (interface{}, error) {
+	v, err := e.expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	lower, err := e.lower.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := e.upper.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	lc, lok := compare(v, lower)
+	uc, uok := compare(v, upper)
+	if !lok || !uok {
+		return nil, nil
+	}
+	return (lc >= 0 && uc <= 0) != e.not, nil
+}
+
+type caseExpr struct {
+	// operand is nil for CASE WHEN condition THEN.
+	operand Expr
+	whens   []Expr
+	thens   []Expr
+	els     Expr
+}
+
+func (e *caseExpr) Eval(rec *Record) (interface{}, error) {
+	var v interface{}
+	if e.operand != nil {
+		var err error
+		v, err = e.operand.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, when := range e.whens {
+		w, err := when.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if e.operand != nil {
+			c, comparable := compare(v, w)
+			ok = comparable && c == 0
+		} else {
+			ok = w == true
+		}
+		if ok {
+			return e.thens[i].Eval(rec)
+		}
+	}
+	if e.els == nil {
+		return nil, nil
+	}
+	return e.els.Eval(rec)
+}
+
+type arithExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e *arithExpr) Eval(rec *Record) (interface{}, error) {
+	l, err := e.left.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.right.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(l) || isNull(r) {
+		return nil, nil
+	}
+
+	if e.op == "||" {
+		return toString(l) + toString(r), nil
+	}
+
+	li, liok := l.(int64)
+	ri, riok := r.(int64)
+	if liok && riok {
+		switch e.op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/":
+			if ri == 0 {
+				return nil, errors.Errorf("division by zero")
+			}
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, errors.Errorf("division by zero")
+			}
+			return li % ri, nil
+		}
+	}
+
+	lf, lok := toNumber(l)
+	rf, rok := toNumber(r)
+	if !lok || !rok {
+		return nil, errors.Errorf("%v %s %v is not a number operation", l, e.op, r)
+	}
+	switch e.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	default:
+		return math.Mod(lf, rf), nil
+	}
+}
+
+type castExpr struct {
+	expr Expr
+	typ  string
+}
+
+func (e *castExpr) Eval(rec *Record) (interface{}, error) {
+	v, err := e.expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(v) {
+		return v, nil
+	}
+
+	switch e.typ {
+	case "INT", "INTEGER", "BIGINT", "SMALLINT":
+		switch v := v.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			return int64(v), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case string:
+			s := strings.TrimSpace(v)
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return int64(f), nil
+			}
+		}
+	case "FLOAT", "REAL", "DOUBLE", "DECIMAL", "NUMERIC":
+		if f, ok := toNumber(v); ok {
+			return f, nil
+		}
+	case "STRING", "VARCHAR", "CHAR":
+		return toString(v), nil
+	case "BOOL", "BOOLEAN":
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case float64:
+			return v != 0, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+	case "TIMESTAMP":
+		if t, ok := toTime(v); ok {
+			return t, nil
+		}
+	default:
+		return nil, errors.Errorf("unsupported type %s", e.typ)
+	}
+
+	return nil, errors.Errorf("can't cast %v as %s", v, e.typ)
+}
+
+type callExpr struct {
+	name string
+	args []Expr
+}
+
+func (e *callExpr) Eval(rec *Record) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return functions[e.name](args)
+}
+
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"LOWER": func(args []interface{}) (interface{}, error) {
+		return stringFunc(args, strings.ToLower)
+	},
+	"UPPER": func(args []interface{}) (interface{}, error) {
+		return stringFunc(args, strings.ToUpper)
+	},
+	"TRIM": func(args []interface{}) (interface{}, error) {
+		return stringFunc(args, strings.TrimSpace)
+	},
+	"CHAR_LENGTH": func(args []interface{}) (interface{}, error) {
+		return charLength(args)
+	},
+	"CHARACTER_LENGTH": func(args []interface{}) (interface{}, error) {
+		return charLength(args)
+	},
+	"SUBSTRING": func(args []interface{}) (interface{}, error) {
+		if len(args) < 2 || isNull(args[0]) {
+			return nil, nil
+		}
+		rs := []rune(toString(args[0]))
+		start, ok := toNumber(args[1])
+		if !ok {
+			return nil, errors.Errorf("SUBSTRING start must be a number")
+		}
+		// position is 1-origin, and less than 1 shortens the length.
+		from := int(start) - 1
+		to := len(rs)
+		if len(args) > 2 {
+			length, ok := toNumber(args[2])
+			if !ok {
+				return nil, errors.Errorf("SUBSTRING length must be a number")
+			}
+			to = from + int(length)
+		}
+		if from < 0 {
+			from = 0
+		}
+		if to > len(rs) {
+			to = len(rs)
+		}
+		if from >= to {
+			return "", nil
+		}
+		return string(rs[from:to]), nil
+	},
+	"COALESCE": func(args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if !isNull(arg) {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	},
+	"NULLIF": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.Errorf("NULLIF needs 2 arguments")
+		}
+		if c, ok := compare(args[0], args[1]); ok && c == 0 {
+			return nil, nil
+		}
+		return args[0], nil
+	},
+	"TO_TIMESTAMP": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.Errorf("TO_TIMESTAMP needs 1 argument")
+		}
+		if isNull(args[0]) {
+			return nil, nil
+		}
+		t, ok := toTime(args[0])
+		if !ok {
+			return nil, errors.Errorf("can't parse %v as timestamp", args[0])
+		}
+		return t, nil
+	},
+	"UTCNOW": func(args []interface{}) (interface{}, error) {
+		return time.Now().UTC(), nil
+	},
+}
+
+func stringFunc(args []interface{}, fn func(string) string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.Errorf("needs 1 argument")
+	}
+	if isNull(args[0]) {
+		return nil, nil
+	}
+	return fn(toString(args[0])), nil
+}
+
+func charLength(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.Errorf("CHAR_LENGTH needs 1 argument")
+	}
+	if isNull(args[0]) {
+		return nil, nil
+	}
+	return int64(len([]rune(toString(args[0])))), nil
+}
+
+// aggExpr holds the state of an aggregate function over the records of one object.
+type aggExpr struct {
+	name  string
+	arg   Expr
+	star  bool
+	count int64
+	sum   float64
+	isInt bool
+	isum  int64
+	value interface{}
+}
+
+func (e *aggExpr) accumulate(rec *Record) error {
+	if e.star {
+		e.count++
+		return nil
+	}
+	v, err := e.arg.Eval(rec)
+	if err != nil {
+		return err
+	}
+	if isNull(v) {
+		return nil
+	}
+
+	switch e.name {
+	case "COUNT":
+		e.count++
+	case "SUM", "AVG":
+		if i, ok := v.(int64); ok && (e.count == 0 || e.isInt) {
+			e.isInt = true
+			e.isum += i
+			e.sum += float64(i)
+			e.count++
+			return nil
+		}
+		f, ok := toNumber(v)
+		if !ok {
+			return errors.Errorf("%s of %v is not a number", e.name, v)
+		}
+		e.isInt = false
+		e.sum += f
+		e.count++
+	case "MIN":
+		if c, ok := compare(v, e.value); e.value == nil || (ok && c < 0) {
+			e.value = v
+		}
+	case "MAX":
+		if c, ok := compare(v, e.value); e.value == nil || (ok && c > 0) {
+			e.value = v
+		}
+	}
+	return nil
+}
+
+func (e *aggExpr) Eval(rec *Record) (interface{}, error) {
+	switch e.name {
+	case "COUNT":
+		return e.count, nil
+	case "SUM":
+		if e.count == 0 {
+			return nil, nil
+		}
+		if e.isInt {
+			return e.isum, nil
+		}
+		return e.sum, nil
+	case "AVG":
+		if e.count == 0 {
+			return nil, nil
+		}
+		return e.sum / float64(e.count), nil
+	default:
+		return e.value, nil
+	}
+}
+
+func collectAggs(expr Expr) []*aggExpr {
+	switch e := expr.(type) {
+	case *aggExpr:
+		return []*aggExpr{e}
+	case *logicalExpr:
+		return append(collectAggs(e.left), collectAggs(e.right)...)
+	case *compareExpr:
+		return append(collectAggs(e.left), collectAggs(e.right)...)
+	case *arithExpr:
+		return append(collectAggs(e.left), collectAggs(e.right)...)
+	case *notExpr:
+		return collectAggs(e.expr)
+	case *isExpr:
+		return collectAggs(e.expr)
+	case *castExpr:
+		return collectAggs(e.expr)
+	case *caseExpr:
+		var aggs []*aggExpr
+		for _, expr := range append(append([]Expr{e.operand, e.els}, e.whens...), e.thens...) {
+			if expr != nil {
+				aggs = append(aggs, collectAggs(expr)...)
+			}
+		}
+		return aggs
+	case *callExpr:
+		var aggs []*aggExpr
+		for _, arg := range e.args {
+			aggs = append(aggs, collectAggs(arg)...)
+		}
+		return aggs
+	default:
+		return nil
+	}
+}
+
+func isNull(v interface{}) bool {
+	return v == nil || v == Missing
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	default:
+		return 0, false
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// compare returns false when a and b are not comparable such as NULL.
+func compare(a, b interface{}) (int, bool) {
+	if isNull(a) || isNull(b) {
+		return 0, false
+	}
+
+	switch a := a.(type) {
+	case string:
+		switch b := b.(type) {
+		case string:
+			return strings.Compare(a, b), true
+		case time.Time:
+			if t, ok := toTime(a); ok {
+				return compareTime(t, b), true
+			}
+			return 0, false
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case !a:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+		return 0, false
+	case time.Time:
+		if t, ok := toTime(b); ok {
+			return compareTime(a, t), true
+		}
+		return 0, false
+	}
+
+	af, aok := toNumber(a)
+	bf, bok := toNumber(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
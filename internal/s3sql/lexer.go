@@ -0,0 +1,120 @@
+package s3sql
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) is(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) isSymbol(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+var symbols = []string{"<>", "!=", "<=", ">=", "||", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", ".", "[", "]", ";"}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	rs := []rune(query)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			var sb strings.Builder
+			start := i
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, errors.Errorf("unterminated string at %d", start)
+				}
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(rs[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+		case r == '"' || r == '`':
+			start := i
+			end := indexRune(rs, r, i+1)
+			if end < 0 {
+				return nil, errors.Errorf("unterminated identifier at %d", start)
+			}
+			tokens = append(tokens, token{kind: tokenQuotedIdent, text: string(rs[i+1 : end]), pos: start})
+			i = end + 1
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.' || rs[i] == 'e' || rs[i] == 'E' ||
+				((rs[i] == '+' || rs[i] == '-') && (rs[i-1] == 'e' || rs[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(rs[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(rs[start:i]), pos: start})
+		default:
+			var matched string
+			for _, s := range symbols {
+				if strings.HasPrefix(string(rs[i:min(i+2, len(rs))]), s) {
+					matched = s
+					break
+				}
+			}
+			if matched == "" {
+				return nil, errors.Errorf("unexpected character %q at %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: matched, pos: i})
+			i += len([]rune(matched))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(rs)}), nil
+}
+
+func indexRune(rs []rune, r rune, from int) int {
+	for i := from; i < len(rs); i++ {
+		if rs[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
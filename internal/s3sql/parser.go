@@ -0,0 +1,625 @@
+package s3sql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Statement is a parsed S3 Select query.
+type Statement struct {
+	// Columns is nil for SELECT *.
+	Columns []*Column
+	// FromPath is the path after S3Object such as Records in S3Object[*].Records[*].
+	FromPath []string
+	Alias    string
+	Where    Expr
+	Limit    int
+}
+
+type Column struct {
+	Expr Expr
+	Name string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	alias  string
+}
+
+// Parse parses the subset of S3 Select SQL.
+func Parse(query string) (*Statement, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p := &parser{tokens: tokens}
+	st, err := p.parseStatement()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return st, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(keyword string) bool {
+	if p.peek().is(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if p.peek().isSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(keyword string) error {
+	if !p.accept(keyword) {
+		return p.unexpected(keyword)
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.unexpected(symbol)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(want string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return errors.Errorf("expected %s but got end of query", want)
+	}
+	return errors.Errorf("expected %s but got %q at %d", want, t.text, t.pos)
+}
+
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "LIMIT": true, "AS": true,
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "ESCAPE": true, "IN": true,
+	"BETWEEN": true, "IS": true, "NULL": true, "MISSING": true, "TRUE": true, "FALSE": true,
+	"GROUP": true, "ORDER": true, "CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true,
+}
+
+func (p *parser) parseStatement() (*Statement, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	// the alias is needed to resolve paths in the select list, so read FROM first.
+	start := p.pos
+	depth := 0
+	for t := p.peek(); t.kind != tokenEOF && !(depth == 0 && t.is("FROM")); t = p.peek() {
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		}
+		p.next()
+	}
+	end := p.pos
+
+	st := &Statement{}
+	if err := p.parseFrom(st); err != nil {
+		return nil, err
+	}
+	p.alias = st.Alias
+	rest := p.pos
+
+	p.pos = start
+	if p.acceptSymbol("*") {
+		if p.pos != end {
+			return nil, p.unexpected("FROM")
+		}
+	} else {
+		for i := 1; ; i++ {
+			column, err := p.parseColumn(i)
+			if err != nil {
+				return nil, err
+			}
+			st.Columns = append(st.Columns, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if p.pos != end {
+			return nil, p.unexpected("FROM")
+		}
+	}
+	p.pos = rest
+
+	if p.accept("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		st.Where = where
+	}
+	if p.accept("LIMIT") {
+		t := p.next()
+		if t.kind != tokenNumber {
+			return nil, errors.Errorf("expected number after LIMIT but got %q", t.text)
+		}
+		limit, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		st.Limit = limit
+	}
+	p.acceptSymbol(";")
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected("end of query")
+	}
+
+	return st, nil
+}
+
+func (p *parser) parseFrom(st *Statement) error {
+	if err := p.expect("FROM"); err != nil {
+		return err
+	}
+	if err := p.expect("S3Object"); err != nil {
+		return err
+	}
+	for {
+		switch {
+		case p.acceptSymbol("["):
+			if err := p.expectSymbol("*"); err != nil {
+				return err
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return err
+			}
+		case p.acceptSymbol("."):
+			t := p.next()
+			if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+				return errors.Errorf("expected name after . but got %q", t.text)
+			}
+			st.FromPath = append(st.FromPath, t.text)
+		default:
+			p.accept("AS")
+			if t := p.peek(); (t.kind == tokenIdent && !reservedWords[strings.ToUpper(t.text)]) || t.kind == tokenQuotedIdent {
+				st.Alias = p.next().text
+			}
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseColumn(i int) (*Column, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	column := &Column{Expr: expr, Name: "_" + strconv.Itoa(i)}
+	if path, ok := expr.(*pathExpr); ok && len(path.names) > 0 {
+		column.Name = path.names[len(path.names)-1]
+		if path.star {
+			column.Name = ""
+		}
+	}
+	if p.accept("AS") {
+		t := p.next()
+		if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+			return nil, errors.Errorf("expected alias after AS but got %q", t.text)
+		}
+		column.Name = t.text
+	}
+
+	return column, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.accept("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind == tokenSymbol {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &compareExpr{op: t.text, left: left, right: right}, nil
+		}
+	}
+
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		switch {
+		case p.accept("NULL"):
+			return &isExpr{expr: left, missing: false, not: not}, nil
+		case p.accept("MISSING"):
+			return &isExpr{expr: left, missing: true, not: not}, nil
+		default:
+			return nil, p.unexpected("NULL or MISSING")
+		}
+	}
+
+	not := p.accept("NOT")
+	switch {
+	case p.accept("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var escape Expr
+		if p.accept("ESCAPE") {
+			escape, err = p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &likeExpr{expr: left, pattern: pattern, escape: escape, not: not}, nil
+	case p.accept("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []Expr
+		for {
+			item, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &inExpr{expr: left, list: list, not: not}, nil
+	case p.accept("BETWEEN"):
+		lower, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		upper, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{expr: left, lower: lower, upper: upper, not: not}, nil
+	}
+	if not {
+		return nil, p.unexpected("LIKE, IN or BETWEEN")
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !(t.isSymbol("+") || t.isSymbol("-") || t.isSymbol("||")) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !(t.isSymbol("*") || t.isSymbol("/") || t.isSymbol("%")) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.acceptSymbol("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithExpr{op: "-", left: &literalExpr{value: int64(0)}, right: expr}, nil
+	}
+	p.acceptSymbol("+")
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literalExpr{value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid number %q", t.text)
+		}
+		return &literalExpr{value: f}, nil
+	case tokenString:
+		return &literalExpr{value: t.text}, nil
+	case tokenQuotedIdent:
+		return p.parsePath(t)
+	case tokenSymbol:
+		if t.text == "(" {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	case tokenIdent:
+		switch strings.ToUpper(t.text) {
+		case "TRUE":
+			return &literalExpr{value: true}, nil
+		case "FALSE":
+			return &literalExpr{value: false}, nil
+		case "NULL":
+			return &literalExpr{value: nil}, nil
+		case "MISSING":
+			return &literalExpr{value: Missing}, nil
+		case "CASE":
+			return p.parseCase()
+		}
+		if p.peek().isSymbol("(") {
+			return p.parseCall(t)
+		}
+		return p.parsePath(t)
+	}
+
+	return nil, errors.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// parseCase parses both CASE expr WHEN value THEN ... and CASE WHEN condition THEN ...
+func (p *parser) parseCase() (Expr, error) {
+	e := &caseExpr{}
+	if !p.peek().is("WHEN") {
+		operand, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		e.operand = operand
+	}
+	for p.accept("WHEN") {
+		when, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("THEN"); err != nil {
+			return nil, err
+		}
+		then, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		e.whens = append(e.whens, when)
+		e.thens = append(e.thens, then)
+	}
+	if len(e.whens) == 0 {
+		return nil, p.unexpected("WHEN")
+	}
+	if p.accept("ELSE") {
+		els, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		e.els = els
+	}
+	if err := p.expect("END"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *parser) parsePath(first token) (Expr, error) {
+	path := &pathExpr{}
+	if !(first.kind == tokenIdent && (strings.EqualFold(first.text, p.alias) || strings.EqualFold(first.text, "S3Object"))) {
+		path.names = append(path.names, first.text)
+	}
+	for {
+		switch {
+		case p.acceptSymbol("."):
+			t := p.next()
+			switch {
+			case t.isSymbol("*"):
+				path.star = true
+				return path, nil
+			case t.kind == tokenIdent || t.kind == tokenQuotedIdent:
+				path.names = append(path.names, t.text)
+			default:
+				return nil, errors.Errorf("expected name after . but got %q", t.text)
+			}
+		case p.acceptSymbol("["):
+			t := p.next()
+			switch t.kind {
+			case tokenNumber, tokenString:
+				path.names = append(path.names, t.text)
+			default:
+				return nil, errors.Errorf("expected index but got %q", t.text)
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	p.next() // (
+	fn := strings.ToUpper(name.text)
+	call := &callExpr{name: fn}
+
+	switch fn {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		agg := &aggExpr{name: fn}
+		if fn == "COUNT" && p.acceptSymbol("*") {
+			agg.star = true
+		} else {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			agg.arg = arg
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return agg, nil
+	case "CAST":
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AS"); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, errors.Errorf("expected type after AS but got %q", t.text)
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &castExpr{expr: arg, typ: strings.ToUpper(t.text)}, nil
+	case "SUBSTRING":
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.accept("FROM") || p.acceptSymbol(",") {
+			start, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, start)
+			if p.accept("FOR") || p.acceptSymbol(",") {
+				length, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, length)
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return call, nil
+	}
+
+	if _, ok := functions[fn]; !ok {
+		return nil, errors.Errorf("unsupported function %s", name.text)
+	}
+	if p.acceptSymbol(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+
+	return call, nil
+}
@@ -0,0 +1,371 @@
+package s3sql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Record is a JSON value or a CSV row.
+type Record struct {
+	value  interface{}
+	raw    []byte
+	fields []string
+	// names and header are the column names of CSV with a header line.
+	names  []string
+	header map[string]int
+}
+
+// Get returns the value at the path, or Missing.
+func (rec *Record) Get(names []string) interface{} {
+	if len(names) == 0 {
+		if rec.fields != nil {
+			return rec.csvObject()
+		}
+		return rec.value
+	}
+
+	if rec.fields != nil {
+		i, ok := rec.header[names[0]]
+		if !ok {
+			i, ok = columnIndex(names[0])
+		}
+		if !ok || i >= len(rec.fields) || len(names) > 1 {
+			return Missing
+		}
+		return rec.fields[i]
+	}
+
+	v := rec.value
+	for _, name := range names {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[name]
+			if !ok {
+				return Missing
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(node) {
+				return Missing
+			}
+			v = node[i]
+		default:
+			return Missing
+		}
+	}
+	return v
+}
+
+// columnIndex converts _1 to 0.
+func columnIndex(name string) (int, bool) {
+	if !strings.HasPrefix(name, "_") {
+		return 0, false
+	}
+	i, err := strconv.Atoi(name[1:])
+	if err != nil || i < 1 {
+		return 0, false
+	}
+	return i - 1, true
+}
+
+func (rec *Record) csvObject() map[string]interface{} {
+	obj := make(map[string]interface{}, len(rec.fields))
+	for i, f := range rec.fields {
+		obj[rec.columnName(i)] = f
+	}
+	return obj
+}
+
+func (rec *Record) columnName(i int) string {
+	if i < len(rec.names) {
+		return rec.names[i]
+	}
+	return "_" + strconv.Itoa(i+1)
+}
+
+// MarshalJSON returns the record as S3 Select outputs for SELECT *.
+func (rec *Record) MarshalJSON() ([]byte, error) {
+	if rec.raw != nil {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, rec.raw); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return buf.Bytes(), nil
+	}
+	if rec.fields == nil {
+		return marshalValue(rec.value)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range rec.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(rec.columnName(i))
+		value, _ := json.Marshal(f)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// RecordReader reads records one by one, and returns io.EOF at the end.
+type RecordReader interface {
+	Read() (*Record, error)
+}
+
+type jsonReader struct {
+	decoder  *json.Decoder
+	fromPath []string
+	pending  []interface{}
+}
+
+// NewJSONReader reads JSON values such as JSON lines.
+// With fromPath, each element of the array at the path is a record, such as Records in CloudTrail.
+func NewJSONReader(r io.Reader, fromPath []string) RecordReader {
+	return &jsonReader{decoder: json.NewDecoder(r), fromPath: fromPath}
+}
+
+func (r *jsonReader) Read() (*Record, error) {
+	for len(r.pending) == 0 {
+		var raw json.RawMessage
+		if err := r.decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, errors.WithStack(err)
+		}
+
+		value, err := decodeValue(raw)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if len(r.fromPath) == 0 {
+			return &Record{value: value, raw: raw}, nil
+		}
+
+		doc := &Record{value: value}
+		switch v := doc.Get(r.fromPath).(type) {
+		case []interface{}:
+			r.pending = v
+		case missing:
+		default:
+			r.pending = []interface{}{v}
+		}
+	}
+
+	v := r.pending[0]
+	r.pending = r.pending[1:]
+	return &Record{value: v}, nil
+}
+
+func decodeValue(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeNumber(v), nil
+}
+
+func normalizeNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = normalizeNumber(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeNumber(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+type HeaderInfo int
+
+const (
+	// HeaderNone names columns as _1, _2, and so on.
+	HeaderNone HeaderInfo = iota
+	// HeaderUse names columns by the first record.
+	HeaderUse
+	// HeaderIgnore skips the first record.
+	HeaderIgnore
+)
+
+// CSVConfig is the layout of CSV and other delimited records.
+type CSVConfig struct {
+	Header          HeaderInfo
+	FieldDelimiter  rune
+	RecordDelimiter string
+	Quote           rune
+	// Comment is the prefix of ignored lines. 0 means no comments.
+	Comment rune
+}
+
+type csvReader struct {
+	reader   *bufio.Reader
+	cfg      CSVConfig
+	header   map[string]int
+	names    []string
+	readHead bool
+}
+
+// NewCSVReader reads delimited records such as CSV, ALB logs and CF logs.
+// A quote is only recognized at the beginning of a field, so quotes in the middle of a field are kept as they are.
+func NewCSVReader(r io.Reader, cfg CSVConfig) RecordReader {
+	if cfg.FieldDelimiter == 0 {
+		cfg.FieldDelimiter = ','
+	}
+	if cfg.RecordDelimiter == "" {
+		cfg.RecordDelimiter = "\n"
+	}
+	if cfg.Quote == 0 {
+		cfg.Quote = '"'
+	}
+	return &csvReader{reader: bufio.NewReader(r), cfg: cfg}
+}
+
+func (r *csvReader) Read() (*Record, error) {
+	if !r.readHead {
+		r.readHead = true
+		if r.cfg.Header != HeaderNone {
+			fields, err := r.readFields()
+			if err != nil {
+				return nil, err
+			}
+			if r.cfg.Header == HeaderUse {
+				r.names = fields
+				r.header = make(map[string]int, len(fields))
+				for i, name := range fields {
+					r.header[name] = i
+				}
+			}
+		}
+	}
+
+	fields, err := r.readFields()
+	if err != nil {
+		return nil, err
+	}
+	return &Record{fields: fields, names: r.names, header: r.header}, nil
+}
+
+func (r *csvReader) readFields() ([]string, error) {
+	for {
+		fields, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if fields != nil {
+			return fields, nil
+		}
+	}
+}
+
+// readLine returns nil fields for empty and comment lines.
+func (r *csvReader) readLine() ([]string, error) {
+	var (
+		fields     []string
+		field      strings.Builder
+		inQuote    bool
+		fieldStart = true
+		empty      = true
+		comment    bool
+	)
+
+	for {
+		c, _, err := r.reader.ReadRune()
+		if err == io.EOF {
+			if empty {
+				return nil, io.EOF
+			}
+			if comment {
+				return nil, nil
+			}
+			return append(fields, field.String()), nil
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if !inQuote && r.isRecordDelimiter(c) {
+			if empty || comment {
+				return nil, nil
+			}
+			return append(fields, field.String()), nil
+		}
+		if empty && r.cfg.Comment != 0 && c == r.cfg.Comment {
+			comment = true
+		}
+		empty = false
+		if comment {
+			continue
+		}
+
+		switch {
+		case inQuote && c == r.cfg.Quote:
+			if next, _, err := r.reader.ReadRune(); err == nil {
+				if next == r.cfg.Quote {
+					field.WriteRune(c)
+					continue
+				}
+				if err := r.reader.UnreadRune(); err != nil {
+					return nil, errors.WithStack(err)
+				}
+			}
+			inQuote = false
+		case inQuote:
+			field.WriteRune(c)
+		case c == r.cfg.Quote && fieldStart:
+			inQuote = true
+			fieldStart = false
+		case c == r.cfg.FieldDelimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+			fieldStart = true
+		default:
+			field.WriteRune(c)
+			fieldStart = false
+		}
+	}
+}
+
+// isRecordDelimiter consumes the rest of the record delimiter when c begins it.
+func (r *csvReader) isRecordDelimiter(c rune) bool {
+	first, size := utf8.DecodeRuneInString(r.cfg.RecordDelimiter)
+	if c != first {
+		return false
+	}
+	rest := r.cfg.RecordDelimiter[size:]
+	if rest == "" {
+		return true
+	}
+	b, err := r.reader.Peek(len(rest))
+	if err != nil || string(b) != rest {
+		return false
+	}
+	_, _ = r.reader.Discard(len(rest))
+	return true
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+type CLBLogs struct {
+	Time                   interface{} `json:"time"`
+	Elb                    interface{} `json:"elb"`
+	ClientPort             interface{} `json:"client:port"`
+	BackendPort            interface{} `json:"backend:port"`
+	RequestProcessingTime  interface{} `json:"request_processing_time"`
+	BackendProcessingTime  interface{} `json:"backend_processing_time"`
+	ResponseProcessingTime interface{} `json:"response_processing_time"`
+	ElbStatusCode          interface{} `json:"elb_status_code"`
+	BackendStatusCode      interface{} `json:"backend_status_code"`
+	ReceivedBytes          interface{} `json:"received_bytes"`
+	SentBytes              interface{} `json:"sent_bytes"`
+	Request                interface{} `json:"request"`
+	UserAgent              interface{} `json:"user_agent"`
+	SslCipher              interface{} `json:"ssl_cipher"`
+	SslProtocol            interface{} `json:"ssl_protocol"`
+}
+
+func (schema *CLBLogs) UnmarshalJSON(b []byte) error {
+	raw := map[string]interface{}{}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	schema.Time = raw["_1"]
+	schema.Elb = raw["_2"]
+	schema.ClientPort = raw["_3"]
+	schema.BackendPort = raw["_4"]
+	schema.RequestProcessingTime = raw["_5"]
+	schema.BackendProcessingTime = raw["_6"]
+	schema.ResponseProcessingTime = raw["_7"]
+	schema.ElbStatusCode = raw["_8"]
+	schema.BackendStatusCode = raw["_9"]
+	schema.ReceivedBytes = raw["_10"]
+	schema.SentBytes = raw["_11"]
+	schema.Request = raw["_12"]
+	schema.UserAgent = raw["_13"]
+	schema.SslCipher = raw["_14"]
+	schema.SslProtocol = raw["_15"]
+
+	return nil
+}
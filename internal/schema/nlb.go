@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+type NLBLogs struct {
+	Type                      interface{} `json:"type"`
+	Version                   interface{} `json:"version"`
+	Time                      interface{} `json:"time"`
+	Elb                       interface{} `json:"elb"`
+	Listener                  interface{} `json:"listener"`
+	ClientPort                interface{} `json:"client:port"`
+	DestinationPort           interface{} `json:"destination:port"`
+	ConnectionTime            interface{} `json:"connection_time"`
+	TlsHandshakeTime          interface{} `json:"tls_handshake_time"`
+	ReceivedBytes             interface{} `json:"received_bytes"`
+	SentBytes                 interface{} `json:"sent_bytes"`
+	IncomingTlsAlert          interface{} `json:"incoming_tls_alert"`
+	ChosenCertArn             interface{} `json:"chosen_cert_arn"`
+	ChosenCertSerial          interface{} `json:"chosen_cert_serial"`
+	TlsCipher                 interface{} `json:"tls_cipher"`
+	TlsProtocolVersion        interface{} `json:"tls_protocol_version"`
+	TlsNamedGroup             interface{} `json:"tls_named_group"`
+	DomainName                interface{} `json:"domain_name"`
+	AlpnFeProtocol            interface{} `json:"alpn_fe_protocol"`
+	AlpnBeProtocol            interface{} `json:"alpn_be_protocol"`
+	AlpnClientPreferenceList  interface{} `json:"alpn_client_preference_list"`
+	TlsConnectionCreationTime interface{} `json:"tls_connection_creation_time"`
+}
+
+func (schema *NLBLogs) UnmarshalJSON(b []byte) error {
+	raw := map[string]interface{}{}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	schema.Type = raw["_1"]
+	schema.Version = raw["_2"]
+	schema.Time = raw["_3"]
+	schema.Elb = raw["_4"]
+	schema.Listener = raw["_5"]
+	schema.ClientPort = raw["_6"]
+	schema.DestinationPort = raw["_7"]
+	schema.ConnectionTime = raw["_8"]
+	schema.TlsHandshakeTime = raw["_9"]
+	schema.ReceivedBytes = raw["_10"]
+	schema.SentBytes = raw["_11"]
+	schema.IncomingTlsAlert = raw["_12"]
+	schema.ChosenCertArn = raw["_13"]
+	schema.ChosenCertSerial = raw["_14"]
+	schema.TlsCipher = raw["_15"]
+	schema.TlsProtocolVersion = raw["_16"]
+	schema.TlsNamedGroup = raw["_17"]
+	schema.DomainName = raw["_18"]
+	schema.AlpnFeProtocol = raw["_19"]
+	schema.AlpnBeProtocol = raw["_20"]
+	schema.AlpnClientPreferenceList = raw["_21"]
+	schema.TlsConnectionCreationTime = raw["_22"]
+
+	return nil
+}
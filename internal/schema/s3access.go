@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type S3AccessLogs struct {
+	BucketOwner        interface{} `json:"bucket_owner"`
+	Bucket             interface{} `json:"bucket"`
+	Time               interface{} `json:"time"`
+	RemoteIp           interface{} `json:"remote_ip"`
+	Requester          interface{} `json:"requester"`
+	RequestId          interface{} `json:"request_id"`
+	Operation          interface{} `json:"operation"`
+	Key                interface{} `json:"key"`
+	RequestUri         interface{} `json:"request_uri"`
+	HttpStatus         interface{} `json:"http_status"`
+	ErrorCode          interface{} `json:"error_code"`
+	BytesSent          interface{} `json:"bytes_sent"`
+	ObjectSize         interface{} `json:"object_size"`
+	TotalTime          interface{} `json:"total_time"`
+	TurnAroundTime     interface{} `json:"turn_around_time"`
+	Referer            interface{} `json:"referer"`
+	UserAgent          interface{} `json:"user_agent"`
+	VersionId          interface{} `json:"version_id"`
+	HostId             interface{} `json:"host_id"`
+	SignatureVersion   interface{} `json:"signature_version"`
+	CipherSuite        interface{} `json:"cipher_suite"`
+	AuthenticationType interface{} `json:"authentication_type"`
+	HostHeader         interface{} `json:"host_header"`
+	TlsVersion         interface{} `json:"tls_version"`
+	AccessPointArn     interface{} `json:"access_point_arn"`
+	AclRequired        interface{} `json:"acl_required"`
+}
+
+func (schema *S3AccessLogs) UnmarshalJSON(b []byte) error {
+	raw := map[string]interface{}{}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	schema.BucketOwner = raw["_1"]
+	schema.Bucket = raw["_2"]
+	// [06/Feb/2019:00:00:38 +0000] is split into _3 and _4 by the space.
+	if t, ok := raw["_3"].(string); ok {
+		offset, _ := raw["_4"].(string)
+		schema.Time = strings.Trim(t+" "+offset, "[] ")
+	}
+	schema.RemoteIp = raw["_5"]
+	schema.Requester = raw["_6"]
+	schema.RequestId = raw["_7"]
+	schema.Operation = raw["_8"]
+	schema.Key = raw["_9"]
+	schema.RequestUri = raw["_10"]
+	schema.HttpStatus = raw["_11"]
+	schema.ErrorCode = raw["_12"]
+	schema.BytesSent = raw["_13"]
+	schema.ObjectSize = raw["_14"]
+	schema.TotalTime = raw["_15"]
+	schema.TurnAroundTime = raw["_16"]
+	schema.Referer = raw["_17"]
+	schema.UserAgent = raw["_18"]
+	schema.VersionId = raw["_19"]
+	schema.HostId = raw["_20"]
+	schema.SignatureVersion = raw["_21"]
+	schema.CipherSuite = raw["_22"]
+	schema.AuthenticationType = raw["_23"]
+	schema.HostHeader = raw["_24"]
+	schema.TlsVersion = raw["_25"]
+	schema.AccessPointArn = raw["_26"]
+	schema.AclRequired = raw["_27"]
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package schema
+
+// VPCFlowLogs has the fields up to version 5.
+// The names of the keys are same as the header line of the log file.
+type VPCFlowLogs struct {
+	Version          interface{} `json:"version"`
+	AccountId        interface{} `json:"account-id"`
+	InterfaceId      interface{} `json:"interface-id"`
+	Srcaddr          interface{} `json:"srcaddr"`
+	Dstaddr          interface{} `json:"dstaddr"`
+	Srcport          interface{} `json:"srcport"`
+	Dstport          interface{} `json:"dstport"`
+	Protocol         interface{} `json:"protocol"`
+	Packets          interface{} `json:"packets"`
+	Bytes            interface{} `json:"bytes"`
+	Start            interface{} `json:"start"`
+	End              interface{} `json:"end"`
+	Action           interface{} `json:"action"`
+	LogStatus        interface{} `json:"log-status"`
+	VpcId            interface{} `json:"vpc-id"`
+	SubnetId         interface{} `json:"subnet-id"`
+	InstanceId       interface{} `json:"instance-id"`
+	TcpFlags         interface{} `json:"tcp-flags"`
+	Type             interface{} `json:"type"`
+	PktSrcaddr       interface{} `json:"pkt-srcaddr"`
+	PktDstaddr       interface{} `json:"pkt-dstaddr"`
+	Region           interface{} `json:"region"`
+	AzId             interface{} `json:"az-id"`
+	SublocationType  interface{} `json:"sublocation-type"`
+	SublocationId    interface{} `json:"sublocation-id"`
+	PktSrcAwsService interface{} `json:"pkt-src-aws-service"`
+	PktDstAwsService interface{} `json:"pkt-dst-aws-service"`
+	FlowDirection    interface{} `json:"flow-direction"`
+	TrafficPath      interface{} `json:"traffic-path"`
+}
@@ -0,0 +1,183 @@
+package s3s
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+type keyFilter struct {
+	query         *Query
+	includeRegex  []*regexp.Regexp
+	excludeRegex  []*regexp.Regexp
+	archivePolicy ArchivePolicy
+	errOutput     io.Writer
+	checkpoint    *Checkpoint
+	// isModifiedFilter is false when the prefixes are already narrowed by the time range.
+	isModifiedFilter bool
+
+	// skippedCount and skippedBytes are the totals of filtered keys.
+	skippedCount atomic.Int64
+	skippedBytes atomic.Int64
+	// listRequests is the number of ListObjectsV2 requests to list keys.
+	listRequests atomic.Int64
+	// resumedCount is the number of keys completed in the checkpoint.
+	resumedCount atomic.Int64
+	// matchedCount is the number of keys to select, and isListed is set when all keys are listed.
+	matchedCount atomic.Int64
+	isListed     atomic.Bool
+
+	mu             sync.Mutex
+	storageClasses map[string]StorageClassTotal
+}
+
+func newKeyFilter(query *Query, option *Option) (*keyFilter, error) {
+	f := &keyFilter{
+		query:            query,
+		archivePolicy:    option.ArchivePolicy,
+		errOutput:        option.ErrOutput,
+		checkpoint:       option.Checkpoint,
+		isModifiedFilter: true,
+		storageClasses:   map[string]StorageClassTotal{},
+	}
+	if f.errOutput == nil {
+		f.errOutput = io.Discard
+	}
+	if query == nil {
+		return f, nil
+	}
+
+	for _, pattern := range append(append([]string{}, query.Include...), query.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid glob %q", pattern)
+		}
+	}
+	for _, pattern := range query.IncludeRegex {
+		rep, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		f.includeRegex = append(f.includeRegex, rep)
+	}
+	for _, pattern := range query.ExcludeRegex {
+		rep, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		f.excludeRegex = append(f.excludeRegex, rep)
+	}
+
+	return f, nil
+}
+
+// match returns an error for an archived object when ArchivePolicyFail.
+func (f *keyFilter) match(bucket string, object types.Object) (bool, error) {
+	if f.query != nil && !(f.matchKey(*object.Key) && f.matchSize(object.Size) && f.matchModified(object.LastModified)) {
+		f.skip(object)
+		return false, nil
+	}
+
+	if f.checkpoint != nil && f.checkpoint.isDone(bucket, *object.Key, aws.ToString(object.ETag)) {
+		f.resumedCount.Add(1)
+		return false, nil
+	}
+
+	storageClass := object.StorageClass
+	if storageClass == "" {
+		storageClass = types.ObjectStorageClassStandard
+	}
+	f.mu.Lock()
+	total := f.storageClasses[string(storageClass)]
+	total.Count++
+	total.Bytes += object.Size
+	f.storageClasses[string(storageClass)] = total
+	f.mu.Unlock()
+
+	if isArchived(storageClass) {
+		switch f.archivePolicy {
+		case ArchivePolicyFail:
+			return false, errors.Errorf("s3://%s/%s is in %s storage class", bucket, *object.Key, storageClass)
+		case ArchivePolicyWarn:
+			fmt.Fprintf(f.errOutput, "skip s3://%s/%s in %s storage class\n", bucket, *object.Key, storageClass)
+		}
+		f.skip(object)
+		return false, nil
+	}
+
+	f.matchedCount.Add(1)
+	return true, nil
+}
+
+func (f *keyFilter) skip(object types.Object) {
+	f.skippedCount.Add(1)
+	f.skippedBytes.Add(object.Size)
+}
+
+// isArchived reports whether the object needs restoring before S3 Select.
+func isArchived(storageClass types.ObjectStorageClass) bool {
+	switch storageClass {
+	case types.ObjectStorageClassGlacier, types.ObjectStorageClassDeepArchive:
+		return true
+	}
+	return false
+}
+
+func (f *keyFilter) matchKey(key string) bool {
+	for _, pattern := range f.query.Exclude {
+		if matchGlob(pattern, key) {
+			return false
+		}
+	}
+	for _, rep := range f.excludeRegex {
+		if rep.MatchString(key) {
+			return false
+		}
+	}
+
+	if len(f.query.Include) == 0 && len(f.includeRegex) == 0 {
+		return true
+	}
+	for _, pattern := range f.query.Include {
+		if matchGlob(pattern, key) {
+			return true
+		}
+	}
+	for _, rep := range f.includeRegex {
+		if rep.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *keyFilter) matchSize(size int64) bool {
+	if f.query.MinSize > 0 && size < f.query.MinSize {
+		return false
+	}
+	if f.query.MaxSize > 0 && size > f.query.MaxSize {
+		return false
+	}
+	return true
+}
+
+func (f *keyFilter) matchModified(lastModified *time.Time) bool {
+	return !f.isModifiedFilter || f.query.isModifiedWithin(lastModified)
+}
+
+// matchGlob matches the base name of the key when the pattern has no "/".
+func matchGlob(pattern string, key string) bool {
+	if !strings.Contains(pattern, "/") {
+		key = path.Base(key)
+	}
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
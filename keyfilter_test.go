@@ -0,0 +1,74 @@
+package s3s
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		key     string
+		want    bool
+	}{
+		{
+			name:    "base name",
+			pattern: "*.json",
+			key:     "prefix/2022/a.json",
+			want:    true,
+		},
+		{
+			name:    "base name not matched",
+			pattern: "_SUCCESS",
+			key:     "prefix/_SUCCESS.json",
+			want:    false,
+		},
+		{
+			name:    "full key",
+			pattern: "prefix/*/a.json",
+			key:     "prefix/2022/a.json",
+			want:    true,
+		},
+		{
+			name:    "full key not crossing slash",
+			pattern: "prefix/*.json",
+			key:     "prefix/2022/a.json",
+			want:    false,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := matchGlob(tt.pattern, tt.key)
+			if got != tt.want {
+				t.Errorf("want = %v, but got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewKeyFilterError(t *testing.T) {
+	cases := []struct {
+		name  string
+		query *Query
+	}{
+		{
+			name:  "bad glob",
+			query: &Query{Include: []string{"[a-"}},
+		},
+		{
+			name:  "bad regex",
+			query: &Query{ExcludeRegex: []string{"(a"}},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := newKeyFilter(tt.query, &Option{}); err == nil {
+				t.Errorf("want error, but got nil")
+			}
+		})
+	}
+}
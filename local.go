@@ -0,0 +1,190 @@
+package s3s
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/koluku/s3s/internal/s3sql"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+type EngineType int
+
+const (
+	// EngineTypeAuto uses S3 Select, and falls back to EngineTypeLocal when S3 Select is unavailable.
+	EngineTypeAuto EngineType = iota
+	EngineTypeS3Select
+	// EngineTypeLocal gets each object and evaluates the query on the client.
+	EngineTypeLocal
+)
+
+func (c *Client) selectObject(ctx context.Context, in chan<- []byte, counter chan<- KeyCount, stats *selectStats, input *s3SelectInput, option *Option) error {
+	switch option.EngineType {
+	case EngineTypeS3Select:
+		return c.s3Select(ctx, in, counter, stats, input, option)
+	case EngineTypeLocal:
+		return c.localSelect(ctx, in, counter, stats, input, option)
+	}
+
+	if c.selectUnavailable.Load() {
+		return c.localSelect(ctx, in, counter, stats, input, option)
+	}
+	err := c.s3Select(ctx, in, counter, stats, input, option)
+	if err != nil && isSelectUnavailable(err) {
+		c.selectUnavailable.Store(true)
+		return c.localSelect(ctx, in, counter, stats, input, option)
+	}
+	return err
+}
+
+func isSelectUnavailable(err error) bool {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotImplemented", "MethodNotAllowed", "UnsupportedOperation", "XNotImplemented":
+			return true
+		}
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) localSelect(ctx context.Context, in chan<- []byte, counter chan<- KeyCount, stats *selectStats, input *s3SelectInput, option *Option) error {
+	// local engine reads the whole object at the first range, and ignores the others.
+	if input.ScanRange != nil && input.ScanRange.Start > 0 {
+		return nil
+	}
+
+	getter, ok := c.s3.(ObjectGetter)
+	if !ok {
+		return errors.Errorf("local engine needs GetObject, which the S3API doesn't have")
+	}
+
+	st, err := s3sql.Parse(input.Query)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := getter.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(input.Bucket),
+		Key:    aws.String(input.Key),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	params := input.toParameter()
+	scanned := &countingReader{r: resp.Body}
+	body, err := decompress(scanned, params.InputSerialization.CompressionType)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	processed := &countingReader{r: body}
+	reader, err := recordReader(processed, params.InputSerialization, st.FromPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	pr, pw := io.Pipe()
+
+	eg, egctx := errgroup.WithContext(ctx)
+
+	// execErr, such as a decompression error or a malformed record, is returned after both goroutines
+	// as streamErr of s3SelectOnce. The error of sendRecords comes first, because Exec fails on the closed pipe after it.
+	var returned int64
+	var execErr error
+	eg.Go(func() error {
+		execErr = st.Exec(reader, func(b []byte) error {
+			n, err := pw.Write(append(b, '\n'))
+			returned += int64(n)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return nil
+		})
+		pw.CloseWithError(execErr)
+		return nil
+	})
+
+	eg.Go(func() error {
+		defer pr.Close()
+		if _, err := sendRecords(egctx, pr, in, counter, stats, input, option, 0); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	})
+
+	err = eg.Wait()
+	stats.add(scanned.n, processed.n, returned)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if execErr != nil {
+		return errors.WithStack(execErr)
+	}
+	stats.objects.Add(1)
+
+	return nil
+}
+
+func decompress(r io.Reader, compressionType types.CompressionType) (io.Reader, error) {
+	switch compressionType {
+	case types.CompressionTypeGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return gr, nil
+	case types.CompressionTypeBzip2:
+		return bzip2.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
+
+// recordReader reads the object as same as the input serialization of S3 Select.
+func recordReader(r io.Reader, serialization *types.InputSerialization, fromPath []string) (s3sql.RecordReader, error) {
+	switch {
+	case serialization.JSON != nil:
+		return s3sql.NewJSONReader(r, fromPath), nil
+	case serialization.CSV != nil:
+		cfg := s3sql.CSVConfig{
+			FieldDelimiter:  firstRune(serialization.CSV.FieldDelimiter, ','),
+			RecordDelimiter: aws.ToString(serialization.CSV.RecordDelimiter),
+			Quote:           firstRune(serialization.CSV.QuoteCharacter, '"'),
+			Comment:         firstRune(serialization.CSV.Comments, '#'),
+		}
+		switch serialization.CSV.FileHeaderInfo {
+		case types.FileHeaderInfoUse:
+			cfg.Header = s3sql.HeaderUse
+		case types.FileHeaderInfoIgnore:
+			cfg.Header = s3sql.HeaderIgnore
+		}
+		return s3sql.NewCSVReader(r, cfg), nil
+	default:
+		return nil, errors.Errorf("unsupported input format for local engine")
+	}
+}
+
+func firstRune(s *string, defaultRune rune) rune {
+	if s == nil || *s == "" {
+		return defaultRune
+	}
+	r, _ := utf8.DecodeRuneInString(*s)
+	return r
+}
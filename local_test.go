@@ -0,0 +1,239 @@
+package s3s
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunLocalEngine(t *testing.T) {
+	cases := []struct {
+		name      string
+		engine    EngineType
+		selectErr error
+		query     *Query
+		key       string
+		body      []byte
+		want      string
+	}{
+		{
+			name:   "json lines",
+			engine: EngineTypeLocal,
+			query: &Query{
+				FormatType: FormatTypeJSON,
+				Query:      "SELECT * FROM S3Object s WHERE s.type = 'speak'",
+			},
+			key:  "prefix/a.json",
+			body: []byte(`{"time":1654848930,"type":"speak"}` + "\n" + `{"time":1654848969,"type":"sleep"}` + "\n"),
+			want: `{"time":1654848930,"type":"speak"}` + "\n",
+		},
+		{
+			name:   "gzip cf logs",
+			engine: EngineTypeLocal,
+			query: &Query{
+				FormatType: FormatTypeCFLogs,
+				Query:      "SELECT s._8 FROM S3Object s WHERE s._9 = '404'",
+			},
+			key: "prefix/E2EXAMPLE.2022-09-28-12.abcdef01.gz",
+			body: []byte("#Version: 1.0\n" +
+				"#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status\n" +
+				"2022-09-28\t12:00:00\tNRT57-P1\t100\t192.0.2.1\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\n" +
+				"2022-09-28\t12:00:01\tNRT57-P1\t100\t192.0.2.1\tGET\td111111abcdef8.cloudfront.net\t/missing.html\t404\n"),
+			want: `{"_8":"/missing.html"}` + "\n",
+		},
+		{
+			name:   "vpc flow logs with custom format",
+			engine: EngineTypeLocal,
+			query: &Query{
+				FormatType: FormatTypeVPCFlowLogs,
+				Query:      `SELECT s.srcaddr, s."flow-direction" FROM S3Object s WHERE s."log-status" = 'OK' AND s.action = 'REJECT'`,
+			},
+			key: "prefix/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1235Z_abcdef01.log.gz",
+			body: []byte("srcaddr dstaddr action flow-direction log-status\n" +
+				"10.0.0.1 10.0.0.2 ACCEPT ingress OK\n" +
+				"10.0.0.3 10.0.0.2 REJECT ingress OK\n" +
+				"- - - - NODATA\n"),
+			want: `{"srcaddr":"10.0.0.3","flow-direction":"ingress"}` + "\n",
+		},
+		{
+			name:   "cloudtrail records",
+			engine: EngineTypeLocal,
+			query: &Query{
+				FormatType: FormatTypeCloudTrail,
+				Query:      "SELECT s.eventName FROM S3Object s WHERE s.eventSource = 's3.amazonaws.com'",
+			},
+			key: "prefix/123456789012_CloudTrail_ap-northeast-1_20220928T1235Z_abcdefgh01234567.json.gz",
+			body: []byte(`{"Records":[` +
+				`{"eventSource":"s3.amazonaws.com","eventName":"GetObject"},` +
+				`{"eventSource":"ec2.amazonaws.com","eventName":"RunInstances"},` +
+				`{"eventSource":"s3.amazonaws.com","eventName":"PutObject"}]}`),
+			want: `{"eventName":"GetObject"}` + "\n" + `{"eventName":"PutObject"}` + "\n",
+		},
+		{
+			name:   "s3 access logs",
+			engine: EngineTypeLocal,
+			query: &Query{
+				FormatType: FormatTypeS3AccessLogs,
+				Query:      "SELECT s._3, s._9, s._10 FROM S3Object s WHERE s._11 = '404'",
+			},
+			key: "prefix/2019-02-06-00-00-38-0123456789ABCDEF",
+			body: []byte(`79a59df900b949e5 awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 79a59df900b949e5 3E57427F3EXAMPLE REST.GET.OBJECT index.html "GET /awsexamplebucket1/index.html HTTP/1.1" 200 - 113 113 7 6 "-" "S3Console/0.4" -` + "\n" +
+				`79a59df900b949e5 awsexamplebucket1 [06/Feb/2019:00:00:39 +0000] 192.0.2.3 79a59df900b949e5 3E57427F3EXAMPLF REST.GET.OBJECT missing.html "GET /awsexamplebucket1/missing.html HTTP/1.1" 404 NoSuchKey 290 - 7 - "-" "S3Console/0.4" -` + "\n"),
+			want: `{"_3":"[06/Feb/2019:00:00:39","_9":"missing.html","_10":"GET /awsexamplebucket1/missing.html HTTP/1.1"}` + "\n",
+		},
+		{
+			name:      "fallback when s3 select is not implemented",
+			engine:    EngineTypeAuto,
+			selectErr: &fakeAPIError{code: "NotImplemented"},
+			query: &Query{
+				FormatType: FormatTypeJSON,
+				Query:      "SELECT COUNT(*) FROM S3Object s",
+			},
+			key:  "prefix/a.json",
+			body: []byte(`{"type":"speak"}` + "\n" + `{"type":"sleep"}` + "\n"),
+			want: `{"_1":2}` + "\n",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			body := tt.body
+			if bytes.HasSuffix([]byte(tt.key), []byte(".gz")) {
+				body = gzipBytes(t, body)
+			}
+			api := &fakeS3{
+				objects:   map[string]map[string][]byte{"bucket": {tt.key: body}},
+				selectErr: tt.selectErr,
+			}
+			client := NewFromAPI(api)
+
+			var buf bytes.Buffer
+			if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, tt.query, &Option{EngineType: tt.engine, Output: &buf}); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("want = %s,\nbut got = %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunS3SelectEngineError(t *testing.T) {
+	api := &fakeS3{
+		objects:   map[string]map[string][]byte{"bucket": {"prefix/a.json": []byte(`{}`)}},
+		selectErr: &fakeAPIError{code: "NotImplemented"},
+	}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	var buf bytes.Buffer
+	if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{EngineType: EngineTypeS3Select, Output: &buf}); err == nil {
+		t.Errorf("want error, but got nil")
+	}
+}
+
+func TestRunLocalEngineCorruptObject(t *testing.T) {
+	truncated := gzipBytes(t, []byte(`{"a":1}`+"\n"+`{"a":2}`+"\n"))
+	truncated = truncated[:len(truncated)-4]
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json":            []byte(`{"a":3}` + "\n"),
+				"prefix/truncated.json.gz": truncated,
+				"prefix/malformed.json":    []byte(`{"a":4}` + "\n" + `{"a":` + "\n"),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	var buf bytes.Buffer
+	result, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{EngineType: EngineTypeLocal, Output: &buf, ContinueOnError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, failure := range result.Failures {
+		got[failure.Key] = failure.Class
+	}
+	want := map[string]string{
+		"prefix/truncated.json.gz": "UnexpectedEOF",
+		"prefix/malformed.json":    "UnexpectedEOF",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+// selectOnlyS3 is an S3API without GetObject.
+type selectOnlyS3 struct {
+	api *fakeS3
+}
+
+func (s *selectOnlyS3) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	return s.api.ListBuckets(ctx, params, optFns...)
+}
+
+func (s *selectOnlyS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return s.api.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (s *selectOnlyS3) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (s3.SelectObjectContentEventStreamReader, error) {
+	return s.api.SelectObjectContent(ctx, params, optFns...)
+}
+
+func TestRunWithoutObjectGetter(t *testing.T) {
+	api := &selectOnlyS3{api: &fakeS3{
+		objects: map[string]map[string][]byte{"bucket": {"prefix/a.json": []byte(`{"a":1}` + "\n")}},
+	}}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("s3 select", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{EngineType: EngineTypeS3Select, Output: &buf}); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), `{"a":1}`+"\n"; got != want {
+			t.Errorf("want = %s, but got = %s", want, got)
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{EngineType: EngineTypeLocal, Output: &buf}); err == nil {
+			t.Errorf("want error, but got nil")
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package s3s
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type partitionUnit int
+
+const (
+	partitionUnitYear partitionUnit = iota
+	partitionUnitMonth
+	partitionUnitDay
+	partitionUnitHour
+	partitionUnitMinute
+)
+
+var partitionPlaceholders = map[string]partitionUnit{
+	"YYYY": partitionUnitYear,
+	"MM":   partitionUnitMonth,
+	"DD":   partitionUnitDay,
+	"HH":   partitionUnitHour,
+	"mm":   partitionUnitMinute,
+}
+
+func (u partitionUnit) truncate(t time.Time) time.Time {
+	switch u {
+	case partitionUnitYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	case partitionUnitMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case partitionUnitDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case partitionUnitHour:
+		return t.Truncate(time.Hour)
+	default:
+		return t.Truncate(time.Minute)
+	}
+}
+
+func (u partitionUnit) add(t time.Time) time.Time {
+	switch u {
+	case partitionUnitYear:
+		return t.AddDate(1, 0, 0)
+	case partitionUnitMonth:
+		return t.AddDate(0, 1, 0)
+	case partitionUnitDay:
+		return t.AddDate(0, 0, 1)
+	case partitionUnitHour:
+		return t.Add(time.Hour)
+	default:
+		return t.Add(time.Minute)
+	}
+}
+
+func (u partitionUnit) format(t time.Time) string {
+	switch u {
+	case partitionUnitYear:
+		return t.Format("2006")
+	case partitionUnitMonth:
+		return t.Format("01")
+	case partitionUnitDay:
+		return t.Format("02")
+	case partitionUnitHour:
+		return t.Format("15")
+	default:
+		return t.Format("04")
+	}
+}
+
+// partitionSegment is a literal, followed by a placeholder unless it's the last one.
+type partitionSegment struct {
+	literal     string
+	placeholder string
+}
+
+type partitionTemplate struct {
+	segments []partitionSegment
+	// units are the time units in the template from coarse to fine.
+	units []partitionUnit
+}
+
+func parsePartitionTemplate(template string) (*partitionTemplate, error) {
+	if !strings.Contains(template, "{prefix}") {
+		template = "{prefix}" + template
+	}
+
+	pt := &partitionTemplate{}
+	seen := map[partitionUnit]bool{}
+	rest := template
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			pt.segments = append(pt.segments, partitionSegment{literal: rest})
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, errors.Errorf("unclosed placeholder in partition template: %s", template)
+		}
+		placeholder := rest[start+1 : start+end]
+		if unit, ok := partitionPlaceholders[placeholder]; ok {
+			if !seen[unit] {
+				seen[unit] = true
+				pt.units = append(pt.units, unit)
+			}
+		} else if placeholder != "prefix" {
+			return nil, errors.Errorf("unknown placeholder {%s} in partition template", placeholder)
+		}
+		pt.segments = append(pt.segments, partitionSegment{literal: rest[:start], placeholder: placeholder})
+		rest = rest[start+end+1:]
+	}
+
+	if len(pt.units) == 0 {
+		return nil, errors.Errorf("partition template needs one of {YYYY}, {MM}, {DD}, {HH} or {mm}")
+	}
+	for i := 1; i < len(pt.units); i++ {
+		if pt.units[i] < pt.units[i-1] {
+			return nil, errors.Errorf("placeholders in partition template must be from coarse to fine")
+		}
+	}
+
+	return pt, nil
+}
+
+// render cuts the template after the placeholder of cut and the next "/".
+func (pt *partitionTemplate) render(prefix string, t time.Time, cut partitionUnit) string {
+	var sb strings.Builder
+	finest := pt.units[len(pt.units)-1]
+	for i, seg := range pt.segments {
+		sb.WriteString(seg.literal)
+		switch seg.placeholder {
+		case "":
+		case "prefix":
+			sb.WriteString(prefix)
+		default:
+			unit := partitionPlaceholders[seg.placeholder]
+			sb.WriteString(unit.format(t))
+			if unit == cut && cut != finest && i+1 < len(pt.segments) {
+				literal := pt.segments[i+1].literal
+				if j := strings.Index(literal, "/"); j >= 0 {
+					literal = literal[:j+1]
+				}
+				sb.WriteString(literal)
+				return sb.String()
+			}
+		}
+	}
+	return sb.String()
+}
+
+// expand covers the time range with the coarsest partitions.
+func (pt *partitionTemplate) expand(prefix string, since time.Time, until time.Time) []string {
+	finest := pt.units[len(pt.units)-1]
+	t := finest.truncate(since.UTC())
+	end := finest.add(finest.truncate(until.UTC()))
+
+	var prefixes []string
+	for t.Before(end) {
+		cut := finest
+		for _, unit := range pt.units[:len(pt.units)-1] {
+			if unit.truncate(t).Equal(t) && !unit.add(t).After(end) {
+				cut = unit
+				break
+			}
+		}
+		prefixes = append(prefixes, pt.render(prefix, t, cut))
+		t = cut.add(t)
+	}
+	return prefixes
+}
+
+// OptimizatePartitionPrefixes expands PartitionTemplate of each prefix by Since and Until.
+// The template without {prefix} follows each prefix.
+func (c *Client) OptimizatePartitionPrefixes(ctx context.Context, prefixes []string, keyInfo *Query) ([]string, error) {
+	if keyInfo.PartitionTemplate == "" {
+		return nil, nil
+	}
+	if isTimeZeroRange(keyInfo.Since, keyInfo.Until) {
+		return nil, nil
+	}
+	if keyInfo.Since.IsZero() || keyInfo.Until.IsZero() {
+		return nil, errors.Errorf("partition template needs both since and until")
+	}
+
+	pt, err := parsePartitionTemplate(keyInfo.PartitionTemplate)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var newPrefixes []string
+	for _, prefix := range prefixes {
+		if strings.Contains(keyInfo.PartitionTemplate, "{prefix}") {
+			prefix = strings.TrimSuffix(prefix, "/")
+		}
+		newPrefixes = append(newPrefixes, pt.expand(prefix, keyInfo.Since, keyInfo.Until)...)
+	}
+
+	return newPrefixes, nil
+}
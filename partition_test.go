@@ -0,0 +1,102 @@
+package s3s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptimizatePartitionPrefixes(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		prefix   string
+		since    time.Time
+		until    time.Time
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "firehose hours",
+			template: "{YYYY}/{MM}/{DD}/{HH}/",
+			prefix:   "s3://bucket/app/",
+			since:    time.Date(2024, 1, 1, 22, 30, 0, 0, time.UTC),
+			until:    time.Date(2024, 1, 3, 1, 0, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/app/2024/01/01/22/",
+				"s3://bucket/app/2024/01/01/23/",
+				"s3://bucket/app/2024/01/02/",
+				"s3://bucket/app/2024/01/03/00/",
+				"s3://bucket/app/2024/01/03/01/",
+			},
+		},
+		{
+			name:     "hive days over months",
+			template: "{prefix}/year={YYYY}/month={MM}/day={DD}/",
+			prefix:   "s3://bucket/app/",
+			since:    time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/app/year=2024/month=01/day=30/",
+				"s3://bucket/app/year=2024/month=01/day=31/",
+				"s3://bucket/app/year=2024/month=02/",
+				"s3://bucket/app/year=2024/month=03/day=01/",
+			},
+		},
+		{
+			name:     "date and hour",
+			template: "{prefix}/dt={YYYY}-{MM}-{DD}/hour={HH}/",
+			prefix:   "s3://bucket/app",
+			since:    time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			until:    time.Date(2024, 1, 1, 6, 59, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/app/dt=2024-01-01/hour=05/",
+				"s3://bucket/app/dt=2024-01-01/hour=06/",
+			},
+		},
+		{
+			name:     "unknown placeholder",
+			template: "{prefix}/{YYYY}/{week}/",
+			prefix:   "s3://bucket/app",
+			since:    time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			until:    time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+			wantErr:  true,
+		},
+		{
+			name:     "no time placeholder",
+			template: "{prefix}/logs/",
+			prefix:   "s3://bucket/app",
+			since:    time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			until:    time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			client := NewFromAPI(&fakeS3{})
+			query := &Query{
+				FormatType:        FormatTypeJSON,
+				Since:             tt.since,
+				Until:             tt.until,
+				PartitionTemplate: tt.template,
+			}
+			got, err := client.OptimizatePartitionPrefixes(context.Background(), []string{tt.prefix}, query)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/pkg/errors"
 )
 
@@ -44,9 +45,11 @@ func (c *Client) GetS3Dir(ctx context.Context, bucket string, prefix string) ([]
 }
 
 type s3Object struct {
-	Bucket string
-	Key    string
-	Size   int64
+	Bucket       string
+	Key          string
+	Size         int64
+	StorageClass types.ObjectStorageClass
+	ETag         string
 }
 
 func (c *Client) GetS3OneKey(ctx context.Context, bucket string, prefix string) (*s3Object, error) {
@@ -60,6 +63,9 @@ func (c *Client) GetS3OneKey(ctx context.Context, bucket string, prefix string)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if len(output.Contents) == 0 {
+		return nil, errors.Errorf("no key under prefix s3://%s/%s", bucket, prefix)
+	}
 
 	return &s3Object{
 		Bucket: bucket,
@@ -69,6 +75,14 @@ func (c *Client) GetS3OneKey(ctx context.Context, bucket string, prefix string)
 }
 
 func (c *Client) GetS3Keys(ctx context.Context, sender chan<- s3Object, bucket string, prefix string, info *Query) error {
+	filter, err := newKeyFilter(info, &Option{ArchivePolicy: ArchivePolicySkip})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.listS3Keys(ctx, sender, bucket, prefix, filter)
+}
+
+func (c *Client) listS3Keys(ctx context.Context, sender chan<- s3Object, bucket string, prefix string, filter *keyFilter) error {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
 		Prefix: aws.String(prefix),
@@ -81,12 +95,26 @@ func (c *Client) GetS3Keys(ctx context.Context, sender chan<- s3Object, bucket s
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		filter.listRequests.Add(1)
 
 		for i := range output.Contents {
-			sender <- s3Object{
-				Bucket: bucket,
-				Key:    *output.Contents[i].Key,
-				Size:   output.Contents[i].Size,
+			ok, err := filter.match(bucket, output.Contents[i])
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if !ok {
+				continue
+			}
+			select {
+			case sender <- s3Object{
+				Bucket:       bucket,
+				Key:          *output.Contents[i].Key,
+				Size:         output.Contents[i].Size,
+				StorageClass: output.Contents[i].StorageClass,
+				ETag:         aws.ToString(output.Contents[i].ETag),
+			}:
+			case <-ctx.Done():
+				return nil
 			}
 		}
 	}
@@ -94,8 +122,34 @@ func (c *Client) GetS3Keys(ctx context.Context, sender chan<- s3Object, bucket s
 	return nil
 }
 
+// optimizatePrefixes returns nil when the prefixes can't be narrowed by the time range.
+func (c *Client) optimizatePrefixes(ctx context.Context, prefixes []string, query *Query) ([]string, error) {
+	if query.PartitionTemplate != "" {
+		return c.OptimizatePartitionPrefixes(ctx, prefixes, query)
+	}
+
+	switch query.FormatType {
+	case FormatTypeALBLogs, FormatTypeNLBLogs, FormatTypeCLBLogs:
+		return c.OptimizateALBPrefixes(ctx, prefixes, query)
+	case FormatTypeCFLogs:
+		return c.OptimizateCFPrefixes(ctx, prefixes, query)
+	case FormatTypeVPCFlowLogs:
+		return c.OptimizateVPCFlowLogsPrefixes(ctx, prefixes, query)
+	case FormatTypeCloudTrail:
+		return c.OptimizateCloudTrailPrefixes(ctx, prefixes, query)
+	case FormatTypeS3AccessLogs:
+		return c.OptimizateS3AccessLogsPrefixes(ctx, prefixes, query)
+	case FormatTypeWAFLogs:
+		return c.OptimizateWAFPrefixes(ctx, prefixes, query)
+	}
+	return nil, nil
+}
+
+// OptimizateALBPrefixes also optimizes NLB and CLB, because they have the same key layout as ALB.
 func (c *Client) OptimizateALBPrefixes(ctx context.Context, prefixes []string, keyInfo *Query) ([]string, error) {
-	if keyInfo.FormatType != FormatTypeALBLogs {
+	switch keyInfo.FormatType {
+	case FormatTypeALBLogs, FormatTypeNLBLogs, FormatTypeCLBLogs:
+	default:
 		return nil, nil
 	}
 	if isTimeZeroRange(keyInfo.Since, keyInfo.Until) {
@@ -119,13 +173,19 @@ func (c *Client) OptimizateALBPrefixes(ctx context.Context, prefixes []string, k
 		rep := regexp.MustCompile(`(^.*)\d{4}/\d{2}/\d{2}(.*)_\d{8}T\d{4}Z_`)
 		submatches := rep.FindStringSubmatch(oi.Key)
 		if len(submatches) == 0 {
-			return nil, fmt.Errorf("non-match alb path")
+			return nil, fmt.Errorf("non-match elb path")
 		}
 		prefixA := submatches[1]
 		prefixB := submatches[2]
 
-		since := roundUpTime(keyInfo.Since, time.Minute*5)
-		until := roundUpTime(keyInfo.Until, time.Minute*5)
+		since := roundUpTime(keyInfo.Since.UTC(), time.Minute*5)
+		until := roundUpTime(keyInfo.Until.UTC(), time.Minute*5)
+		// CLB can deliver logs every 60 minutes, and the key has the end of the interval,
+		// so it is listed by hour until the next hour.
+		isHourly := keyInfo.FormatType == FormatTypeCLBLogs
+		if isHourly {
+			until = until.Add(time.Hour)
+		}
 
 		for {
 			if since.After(until) {
@@ -134,10 +194,11 @@ func (c *Client) OptimizateALBPrefixes(ctx context.Context, prefixes []string, k
 			delta := until.Sub(since)
 			if delta >= time.Hour*24 {
 				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s_%s", bucket, prefixA, since.Format("2006/01/02"), prefixB, since.Format("20060102")))
-				since = since.Add(time.Hour * 24)
-			} else if delta >= time.Hour {
+				// the prefix covers the whole day, so the next one starts from its end.
+				since = since.Truncate(time.Hour * 24).Add(time.Hour * 24)
+			} else if delta >= time.Hour || isHourly {
 				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s_%s", bucket, prefixA, since.Format("2006/01/02"), prefixB, since.Format("20060102T15")))
-				since = since.Add(time.Hour)
+				since = since.Truncate(time.Hour).Add(time.Hour)
 			} else {
 				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s_%s", bucket, prefixA, since.Format("2006/01/02"), prefixB, since.Format("20060102T1504Z")))
 				since = since.Add(time.Minute * 5)
@@ -193,3 +254,243 @@ func (c *Client) OptimizateCFPrefixes(ctx context.Context, prefixes []string, ke
 
 	return newPrefixes, nil
 }
+
+func (c *Client) OptimizateVPCFlowLogsPrefixes(ctx context.Context, prefixes []string, keyInfo *Query) ([]string, error) {
+	if keyInfo.FormatType != FormatTypeVPCFlowLogs {
+		return nil, nil
+	}
+	if isTimeZeroRange(keyInfo.Since, keyInfo.Until) {
+		return nil, nil
+	}
+
+	var newPrefixes []string
+	for _, prefix := range prefixes {
+		u, err := url.Parse(prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var bucket, prefix string
+		bucket = u.Hostname()
+		prefix = strings.TrimPrefix(u.Path, "/")
+		oi, err := c.GetS3OneKey(ctx, bucket, prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// AWSLogs/<account>/vpcflowlogs/<region>/YYYY/MM/DD/[HH/]<account>_vpcflowlogs_<region>_<flow log id>_YYYYMMDDTHHmmZ_<hash>.log.gz
+		rep := regexp.MustCompile(`(^.*)\d{4}/\d{2}/\d{2}(/\d{2})?(/[^/]*)_\d{8}T\d{4}Z_`)
+		submatches := rep.FindStringSubmatch(oi.Key)
+		if len(submatches) == 0 {
+			return nil, fmt.Errorf("non-match vpc flow logs path")
+		}
+		prefixA := submatches[1]
+		isHourly := submatches[2] != ""
+		prefixB := submatches[3]
+
+		dir := func(t time.Time) string {
+			if isHourly {
+				return t.Format("2006/01/02/15")
+			}
+			return t.Format("2006/01/02")
+		}
+
+		since := roundUpTime(keyInfo.Since.UTC(), time.Minute*5)
+		until := roundUpTime(keyInfo.Until.UTC(), time.Minute*5)
+
+		for {
+			if since.After(until) {
+				break
+			}
+			delta := until.Sub(since)
+			if delta >= time.Hour*24 && !isHourly {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s_%s", bucket, prefixA, dir(since), prefixB, since.Format("20060102")))
+				// the prefix covers the whole day, so the next one starts from its end.
+				since = since.Truncate(time.Hour * 24).Add(time.Hour * 24)
+			} else if delta >= time.Hour {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s_%s", bucket, prefixA, dir(since), prefixB, since.Format("20060102T15")))
+				since = since.Truncate(time.Hour).Add(time.Hour)
+			} else {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s_%s", bucket, prefixA, dir(since), prefixB, since.Format("20060102T1504Z")))
+				since = since.Add(time.Minute * 5)
+			}
+		}
+	}
+
+	return newPrefixes, nil
+}
+
+// OptimizateCloudTrailPrefixes lists the prefixes by day,
+// because CloudTrail delivers events some minutes after they happened.
+func (c *Client) OptimizateCloudTrailPrefixes(ctx context.Context, prefixes []string, keyInfo *Query) ([]string, error) {
+	if keyInfo.FormatType != FormatTypeCloudTrail {
+		return nil, nil
+	}
+	if isTimeZeroRange(keyInfo.Since, keyInfo.Until) {
+		return nil, nil
+	}
+
+	var newPrefixes []string
+	for _, prefix := range prefixes {
+		u, err := url.Parse(prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var bucket, prefix string
+		bucket = u.Hostname()
+		prefix = strings.TrimPrefix(u.Path, "/")
+		oi, err := c.GetS3OneKey(ctx, bucket, prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// AWSLogs/[<organization id>/]<account>/CloudTrail/<region>/YYYY/MM/DD/<account>_CloudTrail_<region>_YYYYMMDDTHHmmZ_<random>.json.gz
+		rep := regexp.MustCompile(`(^.*/CloudTrail/)[^/]+/\d{4}/\d{2}/\d{2}/`)
+		submatches := rep.FindStringSubmatch(oi.Key)
+		if len(submatches) == 0 {
+			return nil, fmt.Errorf("non-match cloudtrail path")
+		}
+
+		// a multi-region trail has a directory per region,
+		// so list them and keep the ones under the given prefix.
+		regionDirs, err := c.GetS3Dir(ctx, bucket, submatches[1])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, prefixA := range regionDirs {
+			if !strings.HasPrefix(prefixA, prefix) && !strings.HasPrefix(prefix, prefixA) {
+				continue
+			}
+
+			since := keyInfo.Since.UTC().Truncate(time.Hour * 24)
+			until := keyInfo.Until.UTC()
+			for {
+				if since.After(until) {
+					break
+				}
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s/", bucket, prefixA, since.Format("2006/01/02")))
+				since = since.Add(time.Hour * 24)
+			}
+		}
+	}
+
+	return newPrefixes, nil
+}
+
+func (c *Client) OptimizateS3AccessLogsPrefixes(ctx context.Context, prefixes []string, keyInfo *Query) ([]string, error) {
+	if keyInfo.FormatType != FormatTypeS3AccessLogs {
+		return nil, nil
+	}
+	if isTimeZeroRange(keyInfo.Since, keyInfo.Until) {
+		return nil, nil
+	}
+
+	var newPrefixes []string
+	for _, prefix := range prefixes {
+		u, err := url.Parse(prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var bucket, prefix string
+		bucket = u.Hostname()
+		prefix = strings.TrimPrefix(u.Path, "/")
+		oi, err := c.GetS3OneKey(ctx, bucket, prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// flat: <prefix>YYYY-MM-DD-HH-MM-SS-<id>
+		// date-partitioned: <prefix><account>/<region>/<bucket>/YYYY/MM/DD/YYYY-MM-DD-HH-MM-SS-<id>
+		rep := regexp.MustCompile(`^(.*?)(\d{4}/\d{2}/\d{2}/)?\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}-[^/]*$`)
+		submatches := rep.FindStringSubmatch(oi.Key)
+		if len(submatches) == 0 {
+			return nil, fmt.Errorf("non-match s3 access logs path")
+		}
+		prefixA := submatches[1]
+		isPartitioned := submatches[2] != ""
+
+		dir := func(t time.Time) string {
+			if isPartitioned {
+				return t.Format("2006/01/02/")
+			}
+			return ""
+		}
+
+		since := keyInfo.Since.UTC()
+		until := keyInfo.Until.UTC()
+		for {
+			if since.After(until) {
+				break
+			}
+			delta := until.Sub(since)
+			if delta >= time.Hour*24 {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s", bucket, prefixA, dir(since), since.Format("2006-01-02")))
+				// the prefix covers the whole day, so the next one starts from its end.
+				since = since.Truncate(time.Hour * 24).Add(time.Hour * 24)
+			} else {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s%s", bucket, prefixA, dir(since), since.Format("2006-01-02-15")))
+				since = since.Truncate(time.Hour).Add(time.Hour)
+			}
+		}
+	}
+
+	return newPrefixes, nil
+}
+
+func (c *Client) OptimizateWAFPrefixes(ctx context.Context, prefixes []string, keyInfo *Query) ([]string, error) {
+	if keyInfo.FormatType != FormatTypeWAFLogs {
+		return nil, nil
+	}
+	if isTimeZeroRange(keyInfo.Since, keyInfo.Until) {
+		return nil, nil
+	}
+
+	var newPrefixes []string
+	for _, prefix := range prefixes {
+		u, err := url.Parse(prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var bucket, prefix string
+		bucket = u.Hostname()
+		prefix = strings.TrimPrefix(u.Path, "/")
+		oi, err := c.GetS3OneKey(ctx, bucket, prefix)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// direct: AWSLogs/<account>/WAFLogs/<region>/<web acl>/YYYY/MM/DD/HH/mm/<file>
+		// firehose: <prefix>YYYY/MM/DD/HH/<file>
+		rep := regexp.MustCompile(`^(.*?)\d{4}/\d{2}/\d{2}/\d{2}/(\d{2}/)?[^/]*$`)
+		submatches := rep.FindStringSubmatch(oi.Key)
+		if len(submatches) == 0 {
+			return nil, fmt.Errorf("non-match waf path")
+		}
+		prefixA := submatches[1]
+		hasMinute := submatches[2] != ""
+
+		since := keyInfo.Since.UTC().Truncate(time.Hour)
+		until := keyInfo.Until.UTC()
+		if hasMinute {
+			since = keyInfo.Since.UTC().Truncate(time.Minute * 5)
+		}
+
+		for {
+			if since.After(until) {
+				break
+			}
+			delta := until.Sub(since)
+			if delta >= time.Hour*24 && since.Hour() == 0 && since.Minute() == 0 {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s", bucket, prefixA, since.Format("2006/01/02/")))
+				since = since.Add(time.Hour * 24)
+			} else if (delta >= time.Hour && since.Minute() == 0) || !hasMinute {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s", bucket, prefixA, since.Format("2006/01/02/15/")))
+				since = since.Add(time.Hour)
+			} else {
+				newPrefixes = append(newPrefixes, fmt.Sprintf("s3://%s/%s%s", bucket, prefixA, since.Format("2006/01/02/15/04/")))
+				since = since.Add(time.Minute * 5)
+			}
+		}
+	}
+
+	return newPrefixes, nil
+}
@@ -0,0 +1,553 @@
+package s3s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGetS3Keys(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{}`),
+				"prefix/b.json": []byte(`{}`),
+				"other/c.json":  []byte(`{}`),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+
+	ch := make(chan s3Object, 10)
+	if err := client.GetS3Keys(context.Background(), ch, "bucket", "prefix/", &Query{}); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	var got []string
+	for obj := range ch {
+		got = append(got, obj.Key)
+	}
+	sort.Strings(got)
+
+	want := []string{"prefix/a.json", "prefix/b.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestGetS3KeysByLastModified(t *testing.T) {
+	baseTime := time.Date(2022, 9, 28, 12, 0, 0, 0, time.UTC)
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/old.json":     []byte(`{}`),
+				"prefix/slack.json":   []byte(`{}`),
+				"prefix/within.json":  []byte(`{}`),
+				"prefix/late.json":    []byte(`{}`),
+				"prefix/unknown.json": []byte(`{}`),
+			},
+		},
+		lastModified: map[string]time.Time{
+			"prefix/old.json":    baseTime.Add(-time.Hour * 2),
+			"prefix/slack.json":  baseTime.Add(-time.Minute * 10),
+			"prefix/within.json": baseTime.Add(time.Minute * 30),
+			"prefix/late.json":   baseTime.Add(time.Hour * 2),
+		},
+	}
+	client := NewFromAPI(api)
+
+	query := &Query{
+		Since:             baseTime,
+		Until:             baseTime.Add(time.Hour),
+		LastModifiedSlack: time.Minute * 15,
+	}
+	ch := make(chan s3Object, 10)
+	if err := client.GetS3Keys(context.Background(), ch, "bucket", "prefix/", query); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	var got []string
+	for obj := range ch {
+		got = append(got, obj.Key)
+	}
+	sort.Strings(got)
+
+	want := []string{"prefix/slack.json", "prefix/unknown.json", "prefix/within.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestOptimizatePrefixesEmpty(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {},
+		},
+	}
+	client := NewFromAPI(api)
+
+	for _, formatType := range []FormatType{FormatTypeALBLogs, FormatTypeCFLogs, FormatTypeVPCFlowLogs, FormatTypeCloudTrail, FormatTypeS3AccessLogs, FormatTypeWAFLogs} {
+		formatType := formatType
+		t.Run(fmt.Sprintf("format %d", formatType), func(t *testing.T) {
+			t.Parallel()
+			query := &Query{
+				FormatType: formatType,
+				Since:      time.Date(2022, 9, 28, 12, 30, 0, 0, time.UTC),
+				Until:      time.Date(2022, 9, 28, 12, 40, 0, 0, time.UTC),
+			}
+			if _, err := client.optimizatePrefixes(context.Background(), []string{"s3://bucket/AWSLogs/"}, query); err == nil {
+				t.Errorf("want error, but got nil")
+			}
+		})
+	}
+}
+
+func TestOptimizateALBPrefixes(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_app.my-alb.0123456789abcdef_20220928T1235Z_10.0.0.1_abcdefgh.log.gz": []byte(``),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+
+	query := &Query{
+		FormatType: FormatTypeALBLogs,
+		Since:      time.Date(2022, 9, 28, 12, 30, 0, 0, time.UTC),
+		Until:      time.Date(2022, 9, 28, 12, 40, 0, 0, time.UTC),
+	}
+	got, err := client.OptimizateALBPrefixes(context.Background(), []string{"s3://bucket/AWSLogs/"}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := "s3://bucket/AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_app.my-alb.0123456789abcdef_"
+	want := []string{
+		base + "20220928T1230Z",
+		base + "20220928T1235Z",
+		base + "20220928T1240Z",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestOptimizateALBPrefixesForNLBAndCLB(t *testing.T) {
+	cases := []struct {
+		name       string
+		formatType FormatType
+		key        string
+		want       []string
+	}{
+		{
+			name:       "nlb",
+			formatType: FormatTypeNLBLogs,
+			key:        "AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_net.my-nlb.0123456789abcdef_20220928T1235Z_abcdefgh.log.gz",
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_net.my-nlb.0123456789abcdef_20220928T1230Z",
+				"s3://bucket/AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_net.my-nlb.0123456789abcdef_20220928T1235Z",
+			},
+		},
+		{
+			// the hourly object of 12:30 is 20220928T1300Z at most.
+			name:       "clb by hour",
+			formatType: FormatTypeCLBLogs,
+			key:        "AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_my-clb_20220928T1235Z_10.0.0.1_abcdefgh.log",
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_my-clb_20220928T12",
+				"s3://bucket/AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_my-clb_20220928T13",
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeS3{
+				objects: map[string]map[string][]byte{
+					"bucket": {tt.key: []byte(``)},
+				},
+			}
+			client := NewFromAPI(api)
+
+			query := &Query{
+				FormatType: tt.formatType,
+				Since:      time.Date(2022, 9, 28, 12, 30, 0, 0, time.UTC),
+				Until:      time.Date(2022, 9, 28, 12, 35, 0, 0, time.UTC),
+			}
+			got, err := client.OptimizateALBPrefixes(context.Background(), []string{"s3://bucket/AWSLogs/"}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOptimizateALBPrefixesUnaligned(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/2022/09/28/123456789012_elasticloadbalancing_ap-northeast-1_app.my-alb.0123456789abcdef_20220928T1235Z_10.0.0.1_abcdefgh.log.gz": []byte(``),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+
+	// since is 00:30 in UTC, and the hour of 00 on 09/28 must not be skipped after the day of 09/27.
+	query := &Query{
+		FormatType: FormatTypeALBLogs,
+		Since:      time.Date(2022, 9, 27, 9, 30, 0, 0, time.FixedZone("JST", 9*60*60)),
+		Until:      time.Date(2022, 9, 28, 10, 5, 0, 0, time.FixedZone("JST", 9*60*60)),
+	}
+	got, err := client.OptimizateALBPrefixes(context.Background(), []string{"s3://bucket/AWSLogs/"}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := "s3://bucket/AWSLogs/123456789012/elasticloadbalancing/ap-northeast-1/"
+	file := "123456789012_elasticloadbalancing_ap-northeast-1_app.my-alb.0123456789abcdef_"
+	want := []string{
+		base + "2022/09/27/" + file + "20220927",
+		base + "2022/09/28/" + file + "20220928T00",
+		base + "2022/09/28/" + file + "20220928T0100Z",
+		base + "2022/09/28/" + file + "20220928T0105Z",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestOptimizateCFPrefixes(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"cf/E2EXAMPLE.2022-09-28-12.abcdef01.gz": []byte(``),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+
+	query := &Query{
+		FormatType: FormatTypeCFLogs,
+		Since:      time.Date(2022, 9, 28, 11, 0, 0, 0, time.UTC),
+		Until:      time.Date(2022, 9, 28, 12, 0, 0, 0, time.UTC),
+	}
+	got, err := client.OptimizateCFPrefixes(context.Background(), []string{"s3://bucket/cf/"}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"s3://bucket/cf/E2EXAMPLE.2022-09-28-11.",
+		"s3://bucket/cf/E2EXAMPLE.2022-09-28-12.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestOptimizateVPCFlowLogsPrefixes(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		since time.Time
+		until time.Time
+		want  []string
+	}{
+		{
+			name:  "daily partition",
+			key:   "AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1235Z_abcdef01.log.gz",
+			since: time.Date(2022, 9, 28, 11, 55, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 13, 5, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T11",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T12",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1300Z",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1305Z",
+			},
+		},
+		{
+			name:  "daily partition across days",
+			key:   "AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1235Z_abcdef01.log.gz",
+			since: time.Date(2022, 9, 27, 0, 30, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 1, 5, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/27/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220927",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T00",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T0100Z",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T0105Z",
+			},
+		},
+		{
+			name:  "hourly partition",
+			key:   "AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/12/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1235Z_abcdef01.log.gz",
+			since: time.Date(2022, 9, 28, 11, 55, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 13, 5, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/11/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T11",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/12/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T12",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/13/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1300Z",
+				"s3://bucket/AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2022/09/28/13/123456789012_vpcflowlogs_ap-northeast-1_fl-0123456789abcdef0_20220928T1305Z",
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeS3{
+				objects: map[string]map[string][]byte{
+					"bucket": {tt.key: []byte(``)},
+				},
+			}
+			client := NewFromAPI(api)
+
+			query := &Query{
+				FormatType: FormatTypeVPCFlowLogs,
+				Since:      tt.since,
+				Until:      tt.until,
+			}
+			got, err := client.OptimizateVPCFlowLogsPrefixes(context.Background(), []string{"s3://bucket/AWSLogs/"}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOptimizateCloudTrailPrefixes(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"AWSLogs/123456789012/CloudTrail/ap-northeast-1/2022/09/28/123456789012_CloudTrail_ap-northeast-1_20220928T1235Z_abcdefgh01234567.json.gz": []byte(``),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+
+	query := &Query{
+		FormatType: FormatTypeCloudTrail,
+		Since:      time.Date(2022, 9, 27, 23, 0, 0, 0, time.UTC),
+		Until:      time.Date(2022, 9, 29, 1, 0, 0, 0, time.UTC),
+	}
+	got, err := client.OptimizateCloudTrailPrefixes(context.Background(), []string{"s3://bucket/AWSLogs/"}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"s3://bucket/AWSLogs/123456789012/CloudTrail/ap-northeast-1/2022/09/27/",
+		"s3://bucket/AWSLogs/123456789012/CloudTrail/ap-northeast-1/2022/09/28/",
+		"s3://bucket/AWSLogs/123456789012/CloudTrail/ap-northeast-1/2022/09/29/",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want = %v,\nbut got = %v", want, got)
+	}
+}
+
+func TestOptimizateCloudTrailPrefixesMultiRegion(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"AWSLogs/123456789012/CloudTrail/ap-northeast-1/2022/09/28/123456789012_CloudTrail_ap-northeast-1_20220928T1235Z_abcdefgh01234567.json.gz": []byte(``),
+				"AWSLogs/123456789012/CloudTrail/us-east-1/2022/09/28/123456789012_CloudTrail_us-east-1_20220928T1235Z_abcdefgh01234567.json.gz":           []byte(``),
+				"AWSLogs/123456789012/CloudTrail/us-west-2/2022/09/28/123456789012_CloudTrail_us-west-2_20220928T1235Z_abcdefgh01234567.json.gz":           []byte(``),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+
+	query := &Query{
+		FormatType: FormatTypeCloudTrail,
+		Since:      time.Date(2022, 9, 28, 0, 0, 0, 0, time.UTC),
+		Until:      time.Date(2022, 9, 28, 1, 0, 0, 0, time.UTC),
+	}
+	cases := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "all regions",
+			prefix: "s3://bucket/AWSLogs/",
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/CloudTrail/ap-northeast-1/2022/09/28/",
+				"s3://bucket/AWSLogs/123456789012/CloudTrail/us-east-1/2022/09/28/",
+				"s3://bucket/AWSLogs/123456789012/CloudTrail/us-west-2/2022/09/28/",
+			},
+		},
+		{
+			name:   "regions under the prefix",
+			prefix: "s3://bucket/AWSLogs/123456789012/CloudTrail/us-",
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/CloudTrail/us-east-1/2022/09/28/",
+				"s3://bucket/AWSLogs/123456789012/CloudTrail/us-west-2/2022/09/28/",
+			},
+		},
+		{
+			name:   "one region",
+			prefix: "s3://bucket/AWSLogs/123456789012/CloudTrail/us-east-1/2022/",
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/CloudTrail/us-east-1/2022/09/28/",
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := client.OptimizateCloudTrailPrefixes(context.Background(), []string{tt.prefix}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOptimizateS3AccessLogsPrefixes(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	cases := []struct {
+		name  string
+		key   string
+		since time.Time
+		until time.Time
+		want  []string
+	}{
+		{
+			name:  "flat",
+			key:   "logs/2022-09-28-12-34-56-0123456789ABCDEF",
+			since: time.Date(2022, 9, 28, 11, 0, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 12, 0, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/logs/2022-09-28-11",
+				"s3://bucket/logs/2022-09-28-12",
+			},
+		},
+		{
+			name:  "date-partitioned",
+			key:   "logs/123456789012/ap-northeast-1/source-bucket/2022/09/28/2022-09-28-12-34-56-0123456789ABCDEF",
+			since: time.Date(2022, 9, 28, 11, 0, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 12, 0, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/logs/123456789012/ap-northeast-1/source-bucket/2022/09/28/2022-09-28-11",
+				"s3://bucket/logs/123456789012/ap-northeast-1/source-bucket/2022/09/28/2022-09-28-12",
+			},
+		},
+		{
+			name:  "across days in local time",
+			key:   "logs/2022-09-28-12-34-56-0123456789ABCDEF",
+			since: time.Date(2022, 9, 27, 9, 30, 0, 0, jst),
+			until: time.Date(2022, 9, 28, 10, 0, 0, 0, jst),
+			want: []string{
+				"s3://bucket/logs/2022-09-27",
+				"s3://bucket/logs/2022-09-28-00",
+				"s3://bucket/logs/2022-09-28-01",
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeS3{
+				objects: map[string]map[string][]byte{
+					"bucket": {tt.key: []byte(``)},
+				},
+			}
+			client := NewFromAPI(api)
+
+			query := &Query{
+				FormatType: FormatTypeS3AccessLogs,
+				Since:      tt.since,
+				Until:      tt.until,
+			}
+			got, err := client.OptimizateS3AccessLogsPrefixes(context.Background(), []string{"s3://bucket/logs/"}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOptimizateWAFPrefixes(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		since time.Time
+		until time.Time
+		want  []string
+	}{
+		{
+			name:  "direct delivery",
+			key:   "AWSLogs/123456789012/WAFLogs/ap-northeast-1/my-web-acl/2022/09/28/12/35/123456789012_waflogs_ap-northeast-1_my-web-acl_20220928T1235Z_abcdef01.log.gz",
+			since: time.Date(2022, 9, 28, 11, 50, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 13, 5, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/AWSLogs/123456789012/WAFLogs/ap-northeast-1/my-web-acl/2022/09/28/11/50/",
+				"s3://bucket/AWSLogs/123456789012/WAFLogs/ap-northeast-1/my-web-acl/2022/09/28/11/55/",
+				"s3://bucket/AWSLogs/123456789012/WAFLogs/ap-northeast-1/my-web-acl/2022/09/28/12/",
+				"s3://bucket/AWSLogs/123456789012/WAFLogs/ap-northeast-1/my-web-acl/2022/09/28/13/00/",
+				"s3://bucket/AWSLogs/123456789012/WAFLogs/ap-northeast-1/my-web-acl/2022/09/28/13/05/",
+			},
+		},
+		{
+			name:  "firehose",
+			key:   "waf/2022/09/28/12/aws-waf-logs-stream-1-2022-09-28-12-35-00-abcdef01",
+			since: time.Date(2022, 9, 28, 11, 50, 0, 0, time.UTC),
+			until: time.Date(2022, 9, 28, 13, 5, 0, 0, time.UTC),
+			want: []string{
+				"s3://bucket/waf/2022/09/28/11/",
+				"s3://bucket/waf/2022/09/28/12/",
+				"s3://bucket/waf/2022/09/28/13/",
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeS3{
+				objects: map[string]map[string][]byte{
+					"bucket": {tt.key: []byte(``)},
+				},
+			}
+			client := NewFromAPI(api)
+
+			query := &Query{
+				FormatType: FormatTypeWAFLogs,
+				Since:      tt.since,
+				Until:      tt.until,
+			}
+			got, err := client.OptimizateWAFPrefixes(context.Background(), []string{"s3://bucket/"}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package s3s
+
+import (
+	"time"
+)
+
+const DEFAULT_PROGRESS_INTERVAL = 500 * time.Millisecond
+
+// Progress is a snapshot of a running query passed to Option.OnProgress.
+type Progress struct {
+	// KeysListed is the number of keys to select so far, and IsListed is set when all keys are listed.
+	KeysListed int
+	IsListed   bool
+	// KeysSelected is the number of keys done, including failed ones.
+	KeysSelected int
+	// InFlight is the number of select requests running, counting each range of a split object.
+	InFlight     int
+	Records      int
+	BytesScanned int64
+	Elapsed      time.Duration
+}
+
+// Throughput is the scanned bytes per second.
+func (p Progress) Throughput() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.BytesScanned) / p.Elapsed.Seconds()
+}
+
+// ETA estimates the remaining time from the rate of keys selected, and is zero until all keys are listed.
+func (p Progress) ETA() time.Duration {
+	if !p.IsListed || p.KeysSelected == 0 || p.KeysSelected >= p.KeysListed {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * float64(p.KeysListed-p.KeysSelected) / float64(p.KeysSelected))
+}
+
+type progressReporter struct {
+	filter *keyFilter
+	stats  *selectStats
+	start  time.Time
+	fn     func(Progress)
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newProgressReporter(filter *keyFilter, stats *selectStats, fn func(Progress)) *progressReporter {
+	return &progressReporter{
+		filter: filter,
+		stats:  stats,
+		start:  time.Now(),
+		fn:     fn,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (r *progressReporter) snapshot() Progress {
+	return Progress{
+		KeysListed:   int(r.filter.matchedCount.Load()),
+		IsListed:     r.filter.isListed.Load(),
+		KeysSelected: int(r.stats.done.Load()),
+		InFlight:     int(r.stats.inFlight.Load()),
+		Records:      int(r.stats.emitted.Load()),
+		BytesScanned: r.stats.bytesScanned.Load(),
+		Elapsed:      time.Since(r.start),
+	}
+}
+
+// run calls fn at each interval until close, and once at the end.
+func (r *progressReporter) run(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.fn(r.snapshot())
+		case <-r.stop:
+			r.fn(r.snapshot())
+			return
+		}
+	}
+}
+
+func (r *progressReporter) close() {
+	close(r.stop)
+	<-r.done
+}
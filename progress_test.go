@@ -0,0 +1,85 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressETA(t *testing.T) {
+	cases := []struct {
+		name     string
+		progress Progress
+		want     time.Duration
+	}{
+		{
+			name:     "listing",
+			progress: Progress{KeysListed: 10, KeysSelected: 5, Elapsed: time.Minute},
+			want:     0,
+		},
+		{
+			name:     "nothing selected",
+			progress: Progress{KeysListed: 10, IsListed: true, Elapsed: time.Minute},
+			want:     0,
+		},
+		{
+			name:     "a quarter",
+			progress: Progress{KeysListed: 100, IsListed: true, KeysSelected: 25, Elapsed: time.Minute},
+			want:     3 * time.Minute,
+		},
+		{
+			name:     "done",
+			progress: Progress{KeysListed: 100, IsListed: true, KeysSelected: 100, Elapsed: time.Minute},
+			want:     0,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.progress.ETA(); got != tt.want {
+				t.Errorf("want = %s, but got = %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunOnProgress(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"a":1}` + "\n"),
+				"prefix/b.json": []byte(`{"a":2}` + "\n"),
+			},
+		},
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	var mu sync.Mutex
+	var last Progress
+	option := &Option{
+		Output:     &bytes.Buffer{},
+		EngineType: EngineTypeS3Select,
+		OnProgress: func(p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			last = p
+		},
+	}
+	if _, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/prefix"}, query, option); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := Progress{KeysListed: 2, IsListed: true, KeysSelected: 2, Records: 2, BytesScanned: 16, Elapsed: last.Elapsed}
+	if last != want {
+		t.Errorf("want = %+v,\nbut got = %+v", want, last)
+	}
+}
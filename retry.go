@@ -0,0 +1,64 @@
+package s3s
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const maxSelectRetryDelay = 20 * time.Second
+
+// errIncompleteStream is the stream closed before the End event, which means the records may be truncated.
+var errIncompleteStream = errors.New("stream closed before the end event")
+
+// isRetryable reports whether the error is transient, such as throttling, a server error or a broken connection.
+// The others, such as AccessDenied or a malformed object, fail in the same way on retry.
+func isRetryable(err error) bool {
+	if errors.Is(err, errIncompleteStream) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "SlowDown", "ServiceUnavailable", "InternalError", "RequestTimeout",
+			"Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests", "Busy":
+			return true
+		}
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// sleepBackoff sleeps a random duration up to base * 2^attempt, which is known as full jitter.
+func sleepBackoff(ctx context.Context, base time.Duration, attempt int) error {
+	d := maxSelectRetryDelay
+	if attempt < 16 && base<<attempt < maxSelectRetryDelay {
+		d = base << attempt
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(d)) + 1))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
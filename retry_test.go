@@ -0,0 +1,126 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "slow down", err: errors.WithStack(&fakeAPIError{code: "SlowDown"}), want: true},
+		{name: "internal error event", err: errors.WithStack(&fakeAPIError{code: "InternalError"}), want: true},
+		{name: "incomplete stream", err: errors.WithStack(errIncompleteStream), want: true},
+		{name: "access denied", err: errors.WithStack(&fakeAPIError{code: "AccessDenied"}), want: false},
+		{name: "malformed object", err: errors.WithStack(&fakeAPIError{code: "InvalidTextEncoding"}), want: false},
+		{name: "unknown", err: errors.New("unknown"), want: false},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("want = %t, but got = %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+	newAPI := func(times int) *fakeS3 {
+		return &fakeS3{
+			objects: map[string]map[string][]byte{
+				"bucket": {
+					"prefix/a.json": []byte(`{"a":1}` + "\n" + `{"a":2}` + "\n"),
+				},
+			},
+			streamErr: map[string]error{
+				"prefix/a.json": &fakeAPIError{code: "SlowDown"},
+			},
+			streamErrTimes: map[string]int{
+				"prefix/a.json": times,
+			},
+		}
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("recover without duplicates", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		client := NewFromAPI(newAPI(2), WithSelectRetries(2), WithSelectRetryDelay(time.Millisecond))
+		if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select}); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), `{"a":1}`+"\n"+`{"a":2}`+"\n"; got != want {
+			t.Errorf("want = %s, but got = %s", want, got)
+		}
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		client := NewFromAPI(newAPI(3), WithSelectRetries(2), WithSelectRetryDelay(time.Millisecond))
+		if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select}); err == nil {
+			t.Errorf("want error, but got nil")
+		}
+	})
+}
+
+func TestRunRetryIncompleteStream(t *testing.T) {
+	newAPI := func(times int) *fakeS3 {
+		return &fakeS3{
+			objects: map[string]map[string][]byte{
+				"bucket": {
+					"prefix/a.json": []byte(`{"a":1}` + "\n" + `{"a":2}` + "\n"),
+				},
+			},
+			incomplete: map[string]bool{
+				"prefix/a.json": true,
+			},
+			streamErrTimes: map[string]int{
+				"prefix/a.json": times,
+			},
+		}
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("recover", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		client := NewFromAPI(newAPI(1), WithSelectRetries(1), WithSelectRetryDelay(time.Millisecond))
+		result, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), `{"a":1}`+"\n"+`{"a":2}`+"\n"; got != want {
+			t.Errorf("want = %s, but got = %s", want, got)
+		}
+		if result.SelectRequests != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.SelectRequests)
+		}
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		client := NewFromAPI(newAPI(2), WithSelectRetries(1), WithSelectRetryDelay(time.Millisecond))
+		_, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select})
+		if !errors.Is(err, errIncompleteStream) {
+			t.Errorf("want = %v, but got = %v", errIncompleteStream, err)
+		}
+	})
+}
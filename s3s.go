@@ -3,8 +3,11 @@ package s3s
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -15,8 +18,15 @@ import (
 
 const (
 	DEFAULT_THREAD_COUNT = 150
+	// DEFAULT_LAST_MODIFIED_SLACK is enough for the delivery delay of most AWS logs.
+	DEFAULT_LAST_MODIFIED_SLACK = time.Hour
+	DEFAULT_SELECT_RETRIES      = 5
+	DEFAULT_SELECT_RETRY_DELAY  = 200 * time.Millisecond
+	DEFAULT_SCAN_RANGE_SIZE     = 256 << 20
 )
 
+var errLimitReached = errors.New("limit reached")
+
 type FormatType int
 
 const (
@@ -24,6 +34,13 @@ const (
 	FormatTypeCSV
 	FormatTypeALBLogs
 	FormatTypeCFLogs
+	FormatTypeParquet
+	FormatTypeVPCFlowLogs
+	FormatTypeCloudTrail
+	FormatTypeS3AccessLogs
+	FormatTypeNLBLogs
+	FormatTypeCLBLogs
+	FormatTypeWAFLogs
 )
 
 type Query struct {
@@ -31,109 +48,359 @@ type Query struct {
 	Query      string
 	Since      time.Time
 	Until      time.Time
+	// CSV is the layout of FormatTypeCSV. Comma separated lines without header are used when nil.
+	CSV *CSVOption
+	// LastModifiedSlack widens Since and Until to filter keys by LastModified. Zero means DEFAULT_LAST_MODIFIED_SLACK,
+	// and negative disables the filter. Prefixes narrowed by the key time of a log format or PartitionTemplate aren't filtered,
+	// because logs such as CloudFront are often delivered hours after the time.
+	LastModifiedSlack time.Duration
+	// PartitionTemplate expands Since and Until into prefixes for any format, such as "{prefix}/year={YYYY}/month={MM}/day={DD}/".
+	PartitionTemplate string
+
+	// Include and Exclude are glob patterns of keys. A pattern without "/" matches the base name of the key.
+	Include []string
+	Exclude []string
+	// IncludeRegex and ExcludeRegex are regular expressions of keys.
+	IncludeRegex []string
+	ExcludeRegex []string
+	// MinSize and MaxSize filter keys by the object size. Zero means no limit.
+	MinSize int64
+	MaxSize int64
+}
+
+type CSVHeaderInfo string
+
+const (
+	CSVHeaderInfoNone   CSVHeaderInfo = "NONE"
+	CSVHeaderInfoUse    CSVHeaderInfo = "USE"
+	CSVHeaderInfoIgnore CSVHeaderInfo = "IGNORE"
+)
+
+type CSVOption struct {
+	// HeaderInfo USE names columns by the first line, and IGNORE skips it.
+	HeaderInfo      CSVHeaderInfo
+	FieldDelimiter  string
+	RecordDelimiter string
+	QuoteCharacter  string
+	Comments        string
 }
 
 type Option struct {
 	IsDryRun    bool
 	IsCountMode bool
+	EngineType  EngineType
+	// Limit is the max number of records written to Output over all keys.
+	// The rest of listing and selecting is canceled once it is reached.
+	Limit int
+	// Output is where each selected record is written as a JSON line.
+	// os.Stdout is used when nil.
+	Output io.Writer
+	// ErrOutput is where warnings such as skipped archived objects are written. They are discarded when nil.
+	ErrOutput io.Writer
+	// ArchivePolicy is for objects in GLACIER or DEEP_ARCHIVE, which S3 Select can't read.
+	ArchivePolicy ArchivePolicy
+	// ContinueOnError records the failure of each object in Result.Failures instead of stopping.
+	// Records already written from the failed object are kept.
+	ContinueOnError bool
+	// MaxCost refuses to run the query when its estimated cost in USD is above it. Zero means no limit.
+	// All keys are listed before select to estimate the cost, and a dry run returns the error too.
+	MaxCost float64
+	// Price is for MaxCost, and nil means the price of the region in DefaultPriceTable.
+	Price *Price
+	// OnProgress is called with the progress at each DEFAULT_PROGRESS_INTERVAL, and once at the end.
+	OnProgress func(Progress)
+	// Checkpoint records completed keys and skips the ones of a previous run.
+	// It can't be used with IsCountMode or an aggregation, which output only at the end.
+	Checkpoint *Checkpoint
 }
 
-type Client struct {
-	s3 *s3.Client
+type ArchivePolicy int
+
+const (
+	// ArchivePolicyWarn skips archived objects and writes each key to ErrOutput. It's the default.
+	ArchivePolicyWarn ArchivePolicy = iota
+	// ArchivePolicySkip skips archived objects silently.
+	ArchivePolicySkip
+	// ArchivePolicyFail stops at the first archived object.
+	ArchivePolicyFail
+)
+
+// S3API is the subset of the S3 API used by Client.
+// It is satisfied by an in-memory fake or any S3-compatible store.
+type S3API interface {
+	ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (s3.SelectObjectContentEventStreamReader, error)
 }
 
-func New(ctx context.Context) (*Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// ObjectGetter is an optional capability of S3API for EngineTypeLocal, which gets each object.
+type ObjectGetter interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3Client adapts *s3.Client to S3API, whose SelectObjectContent returns the event stream.
+// Wrap a client made by s3.NewFromConfig with middleware or custom options, and pass it to NewFromAPI.
+type S3Client struct {
+	*s3.Client
+}
+
+var (
+	_ S3API        = (*S3Client)(nil)
+	_ ObjectGetter = (*S3Client)(nil)
+)
+
+func (api *S3Client) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (s3.SelectObjectContentEventStreamReader, error) {
+	resp, err := api.Client.SelectObjectContent(ctx, params, optFns...)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
+	return resp.GetStream(), nil
+}
+
+type Client struct {
+	s3                S3API
+	listConcurrency   int
+	selectConcurrency int
+	region            string
+	selectRetries     int
+	selectRetryDelay  time.Duration
+	scanRangeSize     int64
+	selectUnavailable atomic.Bool
+}
 
-	api := s3.NewFromConfig(cfg)
+func New(ctx context.Context, opts ...ClientOption) (*Client, error) {
+	clientCfg := newClientConfig(opts)
 
-	client := &Client{
-		s3: api,
+	cfg, err := config.LoadDefaultConfig(ctx, clientCfg.loadOptions()...)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
+	client := NewFromAPI(&S3Client{s3.NewFromConfig(cfg, clientCfg.s3Options)}, opts...)
+	client.region = cfg.Region
 	return client, nil
 }
 
+// Region is the region of the client, or empty for a client created by NewFromAPI without WithRegion.
+func (c *Client) Region() string {
+	return c.region
+}
+
+func NewFromAPI(api S3API, opts ...ClientOption) *Client {
+	clientCfg := newClientConfig(opts)
+
+	return &Client{
+		s3:                api,
+		listConcurrency:   clientCfg.listConcurrency,
+		selectConcurrency: clientCfg.selectConcurrency,
+		region:            clientCfg.region,
+		selectRetries:     clientCfg.selectRetries,
+		selectRetryDelay:  clientCfg.selectRetryDelay,
+		scanRangeSize:     clientCfg.scanRangeSize,
+	}
+}
+
 type Result struct {
 	Count int
 	Bytes int64
+	// Total is the sum of COUNT(*) over all keys when IsCountMode.
+	Total     int
+	KeyCounts []KeyCount
+	// SkippedCount and SkippedBytes are the totals of keys filtered out before select.
+	SkippedCount int
+	SkippedBytes int64
+	// StorageClasses breaks down the keys matched by the filters, including archived ones.
+	StorageClasses map[string]StorageClassTotal
+	// Failures are the objects failed to be selected when ContinueOnError.
+	Failures []Failure
+	// ListRequests and SelectRequests are the numbers of requests for EstimateCost and ActualCost.
+	ListRequests   int
+	SelectRequests int
+	// EstimatedBytes and EstimatedSelectRequests are counted from the listed keys for EstimateCost,
+	// in a dry run or with MaxCost.
+	EstimatedBytes          int64
+	EstimatedSelectRequests int
+	// Objects and Records are the numbers of objects selected and records returned.
+	Objects int
+	Records int
+	// ResumedCount is the number of keys skipped as completed in Checkpoint.
+	ResumedCount int
+	// BytesScanned, BytesProcessed and BytesReturned are the sums of Stats events of S3 Select,
+	// including retries, or the bytes read by local engine.
+	BytesScanned   int64
+	BytesProcessed int64
+	BytesReturned  int64
+}
+
+type StorageClassTotal struct {
+	Count int
+	Bytes int64
+}
+
+type KeyCount struct {
+	Bucket string
+	Key    string
+	Count  int
 }
 
 func (c *Client) Run(ctx context.Context, prefixes []string, query *Query, option *Option) (*Result, error) {
 	result := &Result{}
 
-	switch query.FormatType {
-	case FormatTypeALBLogs:
-		albPrefixes, err := c.OptimizateALBPrefixes(ctx, prefixes, query)
+	optimizedPrefixes, err := c.optimizatePrefixes(ctx, prefixes, query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if optimizedPrefixes != nil {
+		prefixes = optimizedPrefixes
+	}
+
+	var agg *aggregation
+	if !option.IsCountMode {
+		agg, err = parseAggregation(query.Query)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		if albPrefixes != nil {
-			prefixes = albPrefixes
-		}
-	case FormatTypeCFLogs:
-		cfPrefixes, err := c.OptimizateCFPrefixes(ctx, prefixes, query)
+	}
+	if option.Checkpoint != nil && (option.IsCountMode || agg != nil) {
+		return nil, errors.Errorf("checkpoint can't be used with count mode or aggregation")
+	}
+	selectQuery := query
+	if agg != nil {
+		pushdown := *query
+		pushdown.Query = agg.pushdownQuery()
+		selectQuery = &pushdown
+	}
+
+	filter, err := newKeyFilter(query, option)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	filter.isModifiedFilter = optimizedPrefixes == nil
+
+	failures := &failureReport{}
+	stats := &selectStats{}
+	if option.OnProgress != nil {
+		reporter := newProgressReporter(filter, stats, option.OnProgress)
+		go reporter.run(DEFAULT_PROGRESS_INTERVAL)
+		defer reporter.close()
+	}
+
+	var objects []s3Object
+	isCollected := option.MaxCost > 0 && !option.IsDryRun
+	if isCollected {
+		objects, err = c.collectBucketKeys(ctx, prefixes, filter)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		if cfPrefixes != nil {
-			prefixes = cfPrefixes
+		filter.isListed.Store(true)
+		for _, object := range objects {
+			c.tally(result, object, selectQuery)
+		}
+		result.ListRequests = int(filter.listRequests.Load())
+		if err := c.checkMaxCost(result, option); err != nil {
+			return nil, errors.WithStack(err)
 		}
 	}
 
-	pathCH := make(chan s3Object, DEFAULT_THREAD_COUNT)
+	pathCH := make(chan s3Object, c.listConcurrency)
 	eg, egctx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error {
-		if err := c.getBucketKeys(egctx, pathCH, prefixes, query); err != nil {
+		if isCollected {
+			return sendObjects(egctx, pathCH, objects)
+		}
+		if err := c.getBucketKeys(egctx, pathCH, prefixes, filter); err != nil {
 			return errors.WithStack(err)
 		}
+		filter.isListed.Store(true)
 		return nil
 	})
 
-	jsonCH := make(chan []byte, DEFAULT_THREAD_COUNT)
+	jsonCH := make(chan []byte, c.selectConcurrency)
+	countCH := make(chan KeyCount, c.selectConcurrency)
 
 	if !option.IsDryRun {
 		eg.Go(func() error {
-			if err := c.execS3Select(egctx, pathCH, jsonCH, query, option); err != nil {
+			if err := c.execS3Select(egctx, pathCH, jsonCH, countCH, failures, stats, selectQuery, option); err != nil {
 				return errors.WithStack(err)
 			}
 			return nil
 		})
 	} else {
 		eg.Go(func() error {
-			for c := range pathCH {
-				result.Bytes += c.Size
+			for object := range pathCH {
 				result.Count++
+				result.Bytes += object.Size
+				c.tally(result, object, selectQuery)
 			}
 			return nil
 		})
 	}
 
-	if !option.IsDryRun {
+	outputCH := jsonCH
+	if !option.IsDryRun && agg != nil {
+		aggCH := make(chan []byte, c.selectConcurrency)
 		eg.Go(func() error {
-			if err := c.writeOutput(egctx, jsonCH); err != nil {
+			if err := c.aggregate(egctx, agg, jsonCH, aggCH); err != nil {
 				return errors.WithStack(err)
 			}
 			return nil
 		})
+		outputCH = aggCH
 	}
 
-	if err := eg.Wait(); err != nil {
+	if !option.IsDryRun && !option.IsCountMode {
+		eg.Go(func() error {
+			if err := c.writeOutput(egctx, outputCH, stats, option); err != nil {
+				return errors.WithStack(err)
+			}
+			return nil
+		})
+	}
+
+	if !option.IsDryRun && option.IsCountMode {
+		eg.Go(func() error {
+			// the counts of the ranges split from a key are merged into one.
+			index := map[s3Object]int{}
+			for kc := range countCH {
+				result.Total += kc.Count
+				key := s3Object{Bucket: kc.Bucket, Key: kc.Key}
+				if i, ok := index[key]; ok {
+					result.KeyCounts[i].Count += kc.Count
+					continue
+				}
+				index[key] = len(result.KeyCounts)
+				result.KeyCounts = append(result.KeyCounts, kc)
+			}
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil && !errors.Is(err, errLimitReached) {
 		return nil, errors.WithStack(err)
 	}
+	result.SkippedCount = int(filter.skippedCount.Load())
+	result.ResumedCount = int(filter.resumedCount.Load())
+	result.SkippedBytes = filter.skippedBytes.Load()
+	result.StorageClasses = filter.storageClasses
+	result.Failures = failures.sorted()
+	result.ListRequests = int(filter.listRequests.Load())
+	if option.IsDryRun {
+		if err := c.checkMaxCost(result, option); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else {
+		stats.setResult(result)
+	}
 
 	return result, nil
 }
 
-func (c *Client) getBucketKeys(ctx context.Context, in chan<- s3Object, prefixes []string, info *Query) error {
+func (c *Client) getBucketKeys(ctx context.Context, in chan<- s3Object, prefixes []string, filter *keyFilter) error {
 	defer close(in)
 
 	eg, egctx := errgroup.WithContext(ctx)
-	eg.SetLimit(DEFAULT_THREAD_COUNT)
+	eg.SetLimit(c.listConcurrency)
 	for _, prefix := range prefixes {
 		prefix := prefix
 		eg.Go(func() error {
@@ -144,7 +411,7 @@ func (c *Client) getBucketKeys(ctx context.Context, in chan<- s3Object, prefixes
 			bucket := u.Hostname()
 			newPrefix := strings.TrimPrefix(u.Path, "/")
 
-			if c.GetS3Keys(egctx, in, bucket, newPrefix, info); err != nil {
+			if err := c.listS3Keys(egctx, in, bucket, newPrefix, filter); err != nil {
 				return errors.WithStack(err)
 			}
 			return nil
@@ -158,11 +425,12 @@ func (c *Client) getBucketKeys(ctx context.Context, in chan<- s3Object, prefixes
 	return nil
 }
 
-func (c *Client) execS3Select(ctx context.Context, out <-chan s3Object, in chan<- []byte, query *Query, option *Option) error {
+func (c *Client) execS3Select(ctx context.Context, out <-chan s3Object, in chan<- []byte, counter chan<- KeyCount, failures *failureReport, stats *selectStats, query *Query, option *Option) error {
 	defer close(in)
+	defer close(counter)
 
 	eg, egctx := errgroup.WithContext(ctx)
-	eg.SetLimit(DEFAULT_THREAD_COUNT)
+	eg.SetLimit(c.selectConcurrency)
 
 LOOP:
 	for {
@@ -172,31 +440,47 @@ LOOP:
 				break LOOP
 			}
 
-			var input *s3SelectInput
-			switch query.FormatType {
-			case FormatTypeJSON:
-				input = &s3SelectInput{
-					Bucket: s3object.Bucket,
-					Key:    s3object.Key,
-					Query:  query.Query,
-				}
-			case FormatTypeCSV, FormatTypeALBLogs, FormatTypeCFLogs:
-				input = &s3SelectInput{
-					Bucket: s3object.Bucket,
-					Key:    s3object.Key,
-					Query:  query.Query,
+			inputs := newS3SelectInput(s3object, query).split(s3object.Size, c.scanRangeSize)
+			// the key is done when all ranges split from it finish,
+			// and completed for Checkpoint when all of them succeed.
+			remaining := &atomic.Int64{}
+			remaining.Store(int64(len(inputs)))
+			failed := &atomic.Bool{}
+
+			for _, input := range inputs {
+				input := input
+				if egctx.Err() != nil {
+					break LOOP
 				}
+				eg.Go(func() error {
+					stats.inFlight.Add(1)
+					defer stats.inFlight.Add(-1)
+					err := c.selectObject(egctx, in, counter, stats, input, option)
+					if err != nil {
+						failed.Store(true)
+					}
+					isLast := remaining.Add(-1) == 0
+					if isLast {
+						defer stats.done.Add(1)
+					}
+					if err != nil {
+						if option.ContinueOnError && egctx.Err() == nil {
+							failures.add(input.Bucket, input.Key, err)
+							return nil
+						}
+						return errors.WithStack(err)
+					}
+					// a cancelled object may have sent only a part of its records.
+					if isLast && !failed.Load() && option.Checkpoint != nil && egctx.Err() == nil {
+						if err := option.Checkpoint.complete(s3object, stats.records.Load(), stats); err != nil {
+							return errors.WithStack(err)
+						}
+					}
+					return nil
+				})
 			}
-			input.FormatType = query.FormatType
-
-			eg.Go(func() error {
-				if err := c.s3Select(egctx, in, input, option); err != nil {
-					return errors.WithStack(err)
-				}
-				return nil
-			})
 		case <-ctx.Done():
-			return nil
+			break LOOP
 		}
 	}
 
@@ -207,7 +491,13 @@ LOOP:
 	return nil
 }
 
-func (c *Client) writeOutput(ctx context.Context, out <-chan []byte) error {
+func (c *Client) writeOutput(ctx context.Context, out <-chan []byte, stats *selectStats, option *Option) error {
+	w := option.Output
+	if w == nil {
+		w = os.Stdout
+	}
+
+	var count int
 	for {
 		select {
 		case json, ok := <-out:
@@ -215,7 +505,20 @@ func (c *Client) writeOutput(ctx context.Context, out <-chan []byte) error {
 				return nil
 			}
 
-			fmt.Println(string(json))
+			if _, err := fmt.Fprintln(w, string(json)); err != nil {
+				return errors.WithStack(err)
+			}
+			stats.emitted.Add(1)
+			if option.Checkpoint != nil {
+				if err := option.Checkpoint.flush(stats.emitted.Load()); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			count++
+			if option.Limit > 0 && count >= option.Limit {
+				return errLimitReached
+			}
 		case <-ctx.Done():
 			return nil
 		}
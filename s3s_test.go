@@ -0,0 +1,518 @@
+package s3s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestWriteOutput(t *testing.T) {
+	records := [][]byte{
+		[]byte(`{"time":1654848930,"type":"speak"}`),
+		[]byte(`{"time":1654848969,"type":"sleep"}`),
+	}
+
+	ch := make(chan []byte, len(records))
+	for _, r := range records {
+		ch <- r
+	}
+	close(ch)
+
+	var buf bytes.Buffer
+	c := &Client{}
+	if err := c.writeOutput(context.Background(), ch, &selectStats{}, &Option{Output: &buf}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{\"time\":1654848930,\"type\":\"speak\"}\n{\"time\":1654848969,\"type\":\"sleep\"}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want = %s,\nbut got = %s", want, got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"type":"speak"}` + "\n"),
+				"prefix/b.json": []byte(`{"type":"sleep"}` + "\n"),
+				"other/c.json":  []byte(`{"type":"eat"}` + "\n"),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("select", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf}); err != nil {
+			t.Fatal(err)
+		}
+
+		got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		sort.Strings(got)
+		want := []string{`{"type":"sleep"}`, `{"type":"speak"}`}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want = %v,\nbut got = %v", want, got)
+		}
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		result, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{IsDryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.Count)
+		}
+		if result.Bytes != 34 {
+			t.Errorf("want = %d, but got = %d", 34, result.Bytes)
+		}
+	})
+}
+
+func TestRunCountMode(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"_1":3}`),
+				"prefix/b.json": []byte(`{"_1":5}`),
+				"other/c.json":  []byte(`{"_1":7}`),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT COUNT(*) FROM S3Object s",
+	}
+
+	var buf bytes.Buffer
+	result, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{IsCountMode: true, Output: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Total != 8 {
+		t.Errorf("want = %d, but got = %d", 8, result.Total)
+	}
+	if len(result.KeyCounts) != 2 {
+		t.Errorf("want = %d, but got = %d", 2, len(result.KeyCounts))
+	}
+	if buf.Len() != 0 {
+		t.Errorf("want no output, but got = %s", buf.String())
+	}
+}
+
+func TestRunAggregation(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"c1":3,"c2":30}`),
+				"prefix/b.json": []byte(`{"c1":5,"c2":12}`),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT COUNT(*), MAX(s.bytes) FROM S3Object s",
+	}
+
+	var buf bytes.Buffer
+	if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{\"_1\":8,\"_2\":30}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want = %s,\nbut got = %s", want, got)
+	}
+}
+
+func TestRunLimit(t *testing.T) {
+	objects := map[string][]byte{}
+	for i := 0; i < 100; i++ {
+		objects[fmt.Sprintf("prefix/%03d.json", i)] = []byte(`{"a":1}` + "\n" + `{"a":2}` + "\n")
+	}
+	client := NewFromAPI(&fakeS3{objects: map[string]map[string][]byte{"bucket": objects}}, WithSelectConcurrency(2))
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	var buf bytes.Buffer
+	if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Limit: 3, Output: &buf}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Count(buf.String(), "\n"); got != 3 {
+		t.Errorf("want = %d, but got = %d", 3, got)
+	}
+}
+
+func TestRunDryRunKeyFilter(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json":        []byte(`{"a":1}`),
+				"prefix/b.json":        []byte(`{"a":1,"b":2}`),
+				"prefix/empty.json":    []byte(``),
+				"prefix/_SUCCESS":      []byte(``),
+				"prefix/out.manifest":  []byte(`{"entries":[]}`),
+				"prefix/tmp/c.json":    []byte(`{"a":3}`),
+				"prefix/huge.json":     []byte(`{"a":1,"b":2,"c":3,"d":4}`),
+				"prefix/b.json.backup": []byte(`{"a":1,"b":2}`),
+			},
+		},
+	}
+	client := NewFromAPI(api)
+	query := &Query{
+		FormatType:   FormatTypeJSON,
+		Query:        "SELECT * FROM S3Object s",
+		Include:      []string{"*.json"},
+		ExcludeRegex: []string{`/tmp/`},
+		MinSize:      1,
+		MaxSize:      20,
+	}
+
+	result, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{IsDryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Count != 2 {
+		t.Errorf("want = %d, but got = %d", 2, result.Count)
+	}
+	if result.Bytes != 20 {
+		t.Errorf("want = %d, but got = %d", 20, result.Bytes)
+	}
+	if result.SkippedCount != 6 {
+		t.Errorf("want = %d, but got = %d", 6, result.SkippedCount)
+	}
+	if result.SkippedBytes != 59 {
+		t.Errorf("want = %d, but got = %d", 59, result.SkippedBytes)
+	}
+}
+
+func TestRunArchivePolicy(t *testing.T) {
+	newAPI := func() *fakeS3 {
+		return &fakeS3{
+			objects: map[string]map[string][]byte{
+				"bucket": {
+					"prefix/a.json":       []byte(`{"a":1}` + "\n"),
+					"prefix/glacier.json": []byte(`{"a":2}` + "\n"),
+					"prefix/deep.json":    []byte(`{"a":3}` + "\n"),
+				},
+			},
+			storageClass: map[string]types.ObjectStorageClass{
+				"prefix/a.json":       types.ObjectStorageClassStandardIa,
+				"prefix/glacier.json": types.ObjectStorageClassGlacier,
+				"prefix/deep.json":    types.ObjectStorageClassDeepArchive,
+			},
+		}
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		result, err := NewFromAPI(newAPI()).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, ArchivePolicy: ArchivePolicySkip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), `{"a":1}`+"\n"; got != want {
+			t.Errorf("want = %s, but got = %s", want, got)
+		}
+		if result.SkippedCount != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.SkippedCount)
+		}
+	})
+
+	t.Run("warn by default", func(t *testing.T) {
+		t.Parallel()
+		var buf, errBuf bytes.Buffer
+		if _, err := NewFromAPI(newAPI()).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, ErrOutput: &errBuf}); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(errBuf.String(), "\n"); got != 2 {
+			t.Errorf("want = %d, but got = %d", 2, got)
+		}
+		if !strings.Contains(errBuf.String(), "s3://bucket/prefix/glacier.json in GLACIER") {
+			t.Errorf("want warning of glacier.json, but got = %s", errBuf.String())
+		}
+	})
+
+	t.Run("warn without ErrOutput", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		result, err := NewFromAPI(newAPI()).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.SkippedCount != 2 {
+			t.Errorf("want = %d, but got = %d", 2, result.SkippedCount)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		if _, err := NewFromAPI(newAPI()).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, ArchivePolicy: ArchivePolicyFail}); err == nil {
+			t.Errorf("want error, but got nil")
+		}
+	})
+
+	t.Run("dry-run breakdown", func(t *testing.T) {
+		t.Parallel()
+		result, err := NewFromAPI(newAPI()).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{IsDryRun: true, ArchivePolicy: ArchivePolicySkip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]StorageClassTotal{
+			"STANDARD_IA":  {Count: 1, Bytes: 8},
+			"GLACIER":      {Count: 1, Bytes: 8},
+			"DEEP_ARCHIVE": {Count: 1, Bytes: 8},
+		}
+		if !reflect.DeepEqual(result.StorageClasses, want) {
+			t.Errorf("want = %v,\nbut got = %v", want, result.StorageClasses)
+		}
+		if result.Count != 1 {
+			t.Errorf("want = %d, but got = %d", 1, result.Count)
+		}
+	})
+}
+
+func TestRunContinueOnError(t *testing.T) {
+	newAPI := func() *fakeS3 {
+		return &fakeS3{
+			objects: map[string]map[string][]byte{
+				"bucket": {
+					"prefix/a.json":      []byte(`{"a":1}` + "\n"),
+					"prefix/denied.json": []byte(`{"a":2}` + "\n"),
+					"prefix/broken.json": []byte(`{"a":3}` + "\n" + `{"a":`),
+					"prefix/stream.json": []byte(`{"a":4}` + "\n"),
+				},
+			},
+			keyErr: map[string]error{
+				"prefix/denied.json": &fakeAPIError{code: "AccessDenied"},
+			},
+			streamErr: map[string]error{
+				"prefix/stream.json": &fakeAPIError{code: "InternalError"},
+			},
+		}
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	t.Run("continue", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		result, err := NewFromAPI(newAPI(), WithSelectRetries(0)).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select, ContinueOnError: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := map[string]string{}
+		for _, failure := range result.Failures {
+			got[failure.Key] = failure.Class
+		}
+		want := map[string]string{
+			"prefix/denied.json": "AccessDenied",
+			"prefix/broken.json": "UnexpectedEOF",
+			"prefix/stream.json": "InternalError",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want = %v,\nbut got = %v", want, got)
+		}
+		for _, record := range []string{`{"a":1}`, `{"a":3}`, `{"a":4}`} {
+			if !strings.Contains(buf.String(), record) {
+				t.Errorf("want = %s in output, but got = %s", record, buf.String())
+			}
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		if _, err := NewFromAPI(newAPI(), WithSelectRetries(0)).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select}); err == nil {
+			t.Errorf("want error, but got nil")
+		}
+	})
+}
+
+func TestRunScanRange(t *testing.T) {
+	var body []byte
+	for i := 0; i < 10; i++ {
+		body = append(body, fmt.Sprintf(`{"a":%d}`+"\n", i)...)
+	}
+	newAPI := func() *fakeS3 {
+		return &fakeS3{
+			objects: map[string]map[string][]byte{
+				"bucket": {
+					"prefix/a.json": body,
+				},
+			},
+		}
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	for _, engineType := range []EngineType{EngineTypeS3Select, EngineTypeLocal} {
+		engineType := engineType
+		t.Run(fmt.Sprintf("engine %d", engineType), func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			client := NewFromAPI(newAPI(), WithScanRangeSize(15))
+			if _, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: engineType}); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			sort.Strings(got)
+			want := strings.Split(strings.TrimSpace(string(body)), "\n")
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("want = %v,\nbut got = %v", want, got)
+			}
+		})
+	}
+
+	t.Run("count by key", func(t *testing.T) {
+		t.Parallel()
+		api := newAPI()
+		api.objects["bucket"]["prefix/a.json"] = []byte(`{"_1":3}` + "\n" + `{"_1":5}` + "\n")
+		client := NewFromAPI(api, WithScanRangeSize(5))
+		result, err := client.Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{IsCountMode: true, EngineType: EngineTypeS3Select})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []KeyCount{{Bucket: "bucket", Key: "prefix/a.json", Count: 8}}
+		if !reflect.DeepEqual(result.KeyCounts, want) {
+			t.Errorf("want = %v,\nbut got = %v", want, result.KeyCounts)
+		}
+	})
+}
+
+func TestExecS3SelectDoneAfterAllRanges(t *testing.T) {
+	var body []byte
+	for i := 0; i < 10; i++ {
+		body = append(body, fmt.Sprintf(`{"a":%d}`+"\n", i)...)
+	}
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": body,
+			},
+		},
+	}
+	// one by one, so a range starts after the previous one has finished.
+	client := NewFromAPI(api, WithScanRangeSize(15), WithSelectConcurrency(1))
+	stats := &selectStats{}
+	var doneAtSelect []int64
+	api.onSelect = func(params *s3.SelectObjectContentInput) {
+		doneAtSelect = append(doneAtSelect, stats.done.Load())
+	}
+
+	out := make(chan s3Object, 1)
+	out <- s3Object{Bucket: "bucket", Key: "prefix/a.json", Size: int64(len(body))}
+	close(out)
+	in := make(chan []byte, len(body))
+	counter := make(chan KeyCount, len(body))
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+	if err := client.execS3Select(context.Background(), out, in, counter, &failureReport{}, stats, query, &Option{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doneAtSelect) < 2 {
+		t.Fatalf("want = split ranges, but got = %d requests", len(doneAtSelect))
+	}
+	for i, done := range doneAtSelect {
+		if done != 0 {
+			t.Errorf("want = 0 done keys at request %d, but got = %d", i, done)
+		}
+	}
+	if got := stats.done.Load(); got != 1 {
+		t.Errorf("want = %d, but got = %d", 1, got)
+	}
+}
+
+func TestRunModifiedFilter(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"app/2024/01/01/a.json": []byte(`{"a":1}` + "\n"),
+				"app/2024/01/01/b.json": []byte(`{"a":2}` + "\n"),
+			},
+		},
+		lastModified: map[string]time.Time{
+			"app/2024/01/01/a.json": since.Add(time.Hour),
+			// delivered a day late
+			"app/2024/01/01/b.json": since.Add(time.Hour * 24),
+		},
+	}
+
+	cases := []struct {
+		name     string
+		template string
+		slack    time.Duration
+		want     int
+	}{
+		{
+			name: "filtered by LastModified",
+			want: 1,
+		},
+		{
+			name:  "disabled by negative slack",
+			slack: -time.Second,
+			want:  2,
+		},
+		{
+			name:     "narrowed by partition template",
+			template: "{prefix}/{YYYY}/{MM}/{DD}/",
+			want:     2,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			query := &Query{
+				FormatType:        FormatTypeJSON,
+				Query:             "SELECT * FROM S3Object s",
+				Since:             since,
+				Until:             since.Add(time.Hour * 2),
+				LastModifiedSlack: tt.slack,
+				PartitionTemplate: tt.template,
+			}
+			result, err := NewFromAPI(api).Run(context.Background(), []string{"s3://bucket/app"}, query, &Option{IsDryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Count != tt.want {
+				t.Errorf("want = %d, but got = %d", tt.want, result.Count)
+			}
+		})
+	}
+}
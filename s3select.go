@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"regexp"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -19,6 +20,36 @@ type s3SelectInput struct {
 	Bucket     string
 	Key        string
 	Query      string
+	CSV        *CSVOption
+	// ScanRange is the part of the object, and nil means the whole object.
+	ScanRange *types.ScanRange
+}
+
+func newS3SelectInput(s3object s3Object, query *Query) *s3SelectInput {
+	var input *s3SelectInput
+	switch query.FormatType {
+	case FormatTypeJSON, FormatTypeWAFLogs:
+		input = &s3SelectInput{
+			Bucket: s3object.Bucket,
+			Key:    s3object.Key,
+			Query:  query.Query,
+		}
+	case FormatTypeCloudTrail:
+		input = &s3SelectInput{
+			Bucket: s3object.Bucket,
+			Key:    s3object.Key,
+			Query:  recordsQuery(query.Query),
+		}
+	case FormatTypeCSV, FormatTypeALBLogs, FormatTypeNLBLogs, FormatTypeCLBLogs, FormatTypeCFLogs, FormatTypeVPCFlowLogs, FormatTypeS3AccessLogs, FormatTypeParquet:
+		input = &s3SelectInput{
+			Bucket: s3object.Bucket,
+			Key:    s3object.Key,
+			Query:  query.Query,
+		}
+	}
+	input.FormatType = query.FormatType
+	input.CSV = query.CSV
+	return input
 }
 
 func (input *s3SelectInput) toParameter() *s3.SelectObjectContentInput {
@@ -33,36 +64,140 @@ func (input *s3SelectInput) toParameter() *s3.SelectObjectContentInput {
 		OutputSerialization: &types.OutputSerialization{
 			JSON: &types.JSONOutput{},
 		},
+		ScanRange: input.ScanRange,
+		RequestProgress: &types.RequestProgress{
+			Enabled: true,
+		},
 	}
 	switch input.FormatType {
-	case FormatTypeJSON:
+	case FormatTypeJSON, FormatTypeWAFLogs:
 		params.InputSerialization.JSON = &types.JSONInput{
 			Type: types.JSONTypeLines,
 		}
+	case FormatTypeCloudTrail:
+		params.InputSerialization.JSON = &types.JSONInput{
+			Type: types.JSONTypeDocument,
+		}
 	case FormatTypeCSV:
+		params.InputSerialization.CSV = input.csvInput()
+	case FormatTypeALBLogs, FormatTypeNLBLogs, FormatTypeCLBLogs:
+		params.InputSerialization.CSV = &types.CSVInput{
+			FieldDelimiter:  aws.String(" "),
+			RecordDelimiter: aws.String("\n"),
+			FileHeaderInfo:  types.FileHeaderInfoNone,
+		}
+	case FormatTypeCFLogs:
 		params.InputSerialization.CSV = &types.CSVInput{
-			FieldDelimiter:  aws.String(","),
+			FieldDelimiter:  aws.String("\t"),
 			RecordDelimiter: aws.String("\n"),
 			FileHeaderInfo:  types.FileHeaderInfoNone,
 		}
-	case FormatTypeALBLogs:
+	case FormatTypeS3AccessLogs:
+		// the time such as [06/Feb/2019:00:00:38 +0000] is split into _3 and _4.
 		params.InputSerialization.CSV = &types.CSVInput{
 			FieldDelimiter:  aws.String(" "),
 			RecordDelimiter: aws.String("\n"),
+			QuoteCharacter:  aws.String(`"`),
 			FileHeaderInfo:  types.FileHeaderInfoNone,
 		}
-	case FormatTypeCFLogs:
+	case FormatTypeVPCFlowLogs:
+		// the header line declares the fields, because the format of flow logs can be customized.
 		params.InputSerialization.CSV = &types.CSVInput{
-			FieldDelimiter:  aws.String("\t"),
+			FieldDelimiter:  aws.String(" "),
 			RecordDelimiter: aws.String("\n"),
-			FileHeaderInfo:  types.FileHeaderInfoNone,
+			FileHeaderInfo:  types.FileHeaderInfoUse,
 		}
+	case FormatTypeParquet:
+		params.InputSerialization.Parquet = &types.ParquetInput{}
 	}
 
 	return params
 }
 
+// split divides an object larger than rangeSize into the inputs of each ScanRange.
+// S3 Select processes the records which start in the range, so a record across the end of the range is in only one input.
+func (input *s3SelectInput) split(size int64, rangeSize int64) []*s3SelectInput {
+	if rangeSize <= 0 || size <= rangeSize || !input.isSplittable() {
+		return []*s3SelectInput{input}
+	}
+
+	var inputs []*s3SelectInput
+	for start := int64(0); start < size; start += rangeSize {
+		end := start + rangeSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		part := *input
+		part.ScanRange = &types.ScanRange{Start: start, End: end}
+		inputs = append(inputs, &part)
+	}
+	return inputs
+}
+
+// isSplittable reports whether ScanRange is supported, which needs uncompressed JSON lines or CSV without a header.
+// S3 access logs are not split because a quoted field can have the record delimiter.
+func (input *s3SelectInput) isSplittable() bool {
+	if input.suggestCompressionType() != types.CompressionTypeNone {
+		return false
+	}
+
+	switch input.FormatType {
+	case FormatTypeJSON, FormatTypeWAFLogs, FormatTypeALBLogs, FormatTypeNLBLogs, FormatTypeCLBLogs, FormatTypeCFLogs:
+		return true
+	case FormatTypeCSV:
+		return input.csvInput().FileHeaderInfo == types.FileHeaderInfoNone
+	}
+	return false
+}
+
+var fromS3ObjectRegexp = regexp.MustCompile(`(?i)\bFROM\s+S3Object(\[\*\]|\.\w+)*`)
+
+// recordsQuery makes each event in Records of CloudTrail a record,
+// unless the query already has a path after S3Object.
+func recordsQuery(query string) string {
+	return fromS3ObjectRegexp.ReplaceAllStringFunc(query, func(from string) string {
+		if strings.Contains(from, ".") {
+			return from
+		}
+		return "FROM S3Object[*].Records[*]"
+	})
+}
+
+func (input *s3SelectInput) csvInput() *types.CSVInput {
+	csv := &types.CSVInput{
+		FieldDelimiter:  aws.String(","),
+		RecordDelimiter: aws.String("\n"),
+		FileHeaderInfo:  types.FileHeaderInfoNone,
+	}
+	if input.CSV == nil {
+		return csv
+	}
+
+	if input.CSV.HeaderInfo != "" {
+		csv.FileHeaderInfo = types.FileHeaderInfo(input.CSV.HeaderInfo)
+	}
+	if input.CSV.FieldDelimiter != "" {
+		csv.FieldDelimiter = aws.String(input.CSV.FieldDelimiter)
+	}
+	if input.CSV.RecordDelimiter != "" {
+		csv.RecordDelimiter = aws.String(input.CSV.RecordDelimiter)
+	}
+	if input.CSV.QuoteCharacter != "" {
+		csv.QuoteCharacter = aws.String(input.CSV.QuoteCharacter)
+		csv.QuoteEscapeCharacter = aws.String(input.CSV.QuoteCharacter)
+	}
+	if input.CSV.Comments != "" {
+		csv.Comments = aws.String(input.CSV.Comments)
+	}
+	return csv
+}
+
 func (input *s3SelectInput) suggestCompressionType() types.CompressionType {
+	// Parquet compresses columns inside the file, and S3 Select accepts only NONE for it.
+	if input.FormatType == FormatTypeParquet {
+		return types.CompressionTypeNone
+	}
+
 	switch {
 	case strings.HasSuffix(input.Key, ".gz"):
 		return types.CompressionTypeGzip
@@ -73,62 +208,165 @@ func (input *s3SelectInput) suggestCompressionType() types.CompressionType {
 	}
 }
 
-func (c *Client) s3Select(ctx context.Context, in chan<- []byte, input *s3SelectInput, option *Option) error {
+// s3Select retries the object on a retryable error.
+// The records already sent are skipped on retry, because S3 Select returns the same records for the same object.
+func (c *Client) s3Select(ctx context.Context, in chan<- []byte, counter chan<- KeyCount, stats *selectStats, input *s3SelectInput, option *Option) error {
+	var sent int
+	for attempt := 0; ; attempt++ {
+		n, err := c.s3SelectOnce(ctx, in, counter, stats, input, option, sent)
+		if n > sent {
+			sent = n
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.selectRetries || !isRetryable(err) || ctx.Err() != nil {
+			return errors.WithStack(err)
+		}
+		if err := sleepBackoff(ctx, c.selectRetryDelay, attempt); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+}
+
+func (c *Client) s3SelectOnce(ctx context.Context, in chan<- []byte, counter chan<- KeyCount, stats *selectStats, input *s3SelectInput, option *Option, skip int) (int, error) {
 	params := input.toParameter()
-	resp, err := c.s3.SelectObjectContent(ctx, params)
+	stats.requests.Add(1)
+	stream, err := c.s3.SelectObjectContent(ctx, params)
 	if err != nil {
-		return errors.WithStack(err)
+		return skip, errors.WithStack(err)
 	}
-
-	stream := resp.GetStream()
 	defer stream.Close()
 
 	pr, pw := io.Pipe()
 
 	eg, egctx := errgroup.WithContext(ctx)
 
+	// streamErr is returned after both goroutines, because the error given to the pipe may be lost
+	// when sendRecords has already read all the records.
+	var streamErr error
 	eg.Go(func() error {
-		defer pw.Close()
+		// Progress and Stats events are cumulative, so the increase from the last one is added for live progress.
+		// A stream failed before the Stats event counts the bytes until the last Progress event.
+		var last types.Progress
+		update := func(scanned int64, processed int64, returned int64) {
+			stats.add(scanned-last.BytesScanned, processed-last.BytesProcessed, returned-last.BytesReturned)
+			last = types.Progress{BytesScanned: scanned, BytesProcessed: processed, BytesReturned: returned}
+		}
+
+		var isEnd bool
 	LOOP:
 		for event := range stream.Events() {
 			select {
 			case <-egctx.Done():
-				break LOOP
+				pw.CloseWithError(egctx.Err())
+				return nil
 			default:
-				record, ok := event.(*types.SelectObjectContentEventStreamMemberRecords)
-				if ok {
-					pw.Write(record.Value.Payload)
+				switch v := event.(type) {
+				case *types.SelectObjectContentEventStreamMemberRecords:
+					pw.Write(v.Value.Payload)
+				case *types.SelectObjectContentEventStreamMemberProgress:
+					if d := v.Value.Details; d != nil {
+						update(d.BytesScanned, d.BytesProcessed, d.BytesReturned)
+					}
+				case *types.SelectObjectContentEventStreamMemberStats:
+					if d := v.Value.Details; d != nil {
+						update(d.BytesScanned, d.BytesProcessed, d.BytesReturned)
+					}
+				case *types.SelectObjectContentEventStreamMemberEnd:
+					isEnd = true
+					break LOOP
 				}
 			}
 		}
+		// the error of the stream, such as a malformed object or an error event, stops sendRecords through the pipe.
+		if err := stream.Err(); err != nil {
+			streamErr = err
+			pw.CloseWithError(err)
+			return nil
+		}
+		if !isEnd {
+			streamErr = errIncompleteStream
+			pw.CloseWithError(errIncompleteStream)
+			return nil
+		}
+		pw.Close()
 		return nil
 	})
 
+	var sent int
 	eg.Go(func() error {
-		var lines [][]byte
-		decoder := json.NewDecoder(pr)
-		for decoder.More() {
-			var v json.RawMessage
-			if err := decoder.Decode(&v); err != nil {
-				return errors.WithStack(err)
-			}
-			in <- v
+		defer pr.Close()
+		n, err := sendRecords(egctx, pr, in, counter, stats, input, option, skip)
+		sent = n
+		if err != nil {
+			return errors.WithStack(err)
 		}
+		return nil
+	})
+
+	err = eg.Wait()
+	if streamErr != nil {
+		return sent, errors.WithStack(streamErr)
+	}
+	if err != nil {
+		return sent, errors.WithStack(err)
+	}
+	if input.ScanRange == nil || input.ScanRange.Start == 0 {
+		stats.objects.Add(1)
+	}
+
+	return sent, nil
+}
 
-		if option.IsCountMode {
-			var schema schema.Count
-			if err := json.Unmarshal(lines[0], &schema); err != nil {
-				return errors.WithStack(err)
+// sendRecords sends each JSON record read from r, or the sum of them as COUNT(*) in count mode.
+// The first skip records are read but not sent, and it returns the number of records read.
+func sendRecords(ctx context.Context, r io.Reader, in chan<- []byte, counter chan<- KeyCount, stats *selectStats, input *s3SelectInput, option *Option, skip int) (int, error) {
+	var total, read int
+	decoder := json.NewDecoder(r)
+	for {
+		// Decode is called until io.EOF, because More of some versions of encoding/json returns false on the error of r.
+		var v json.RawMessage
+		if err := decoder.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return read, errors.WithStack(err)
+		}
+		read++
+
+		if !option.IsCountMode {
+			if read <= skip {
+				continue
 			}
-			return nil
+			// records is added before sending, so it is never less than the records in the channel for Checkpoint.
+			stats.records.Add(1)
+			select {
+			case in <- v:
+			case <-ctx.Done():
+				stats.records.Add(-1)
+				return read, errors.WithStack(ctx.Err())
+			}
+			continue
 		}
 
-		return nil
-	})
+		var count schema.Count
+		if err := json.Unmarshal(v, &count); err != nil {
+			return read, errors.WithStack(err)
+		}
+		total += count.Count
+	}
 
-	if err := eg.Wait(); err != nil {
-		return errors.WithStack(err)
+	if option.IsCountMode {
+		select {
+		case counter <- KeyCount{
+			Bucket: input.Bucket,
+			Key:    input.Key,
+			Count:  total,
+		}:
+		case <-ctx.Done():
+			return read, errors.WithStack(ctx.Err())
+		}
 	}
 
-	return nil
+	return read, nil
 }
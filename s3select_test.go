@@ -1,9 +1,14 @@
 package s3s
 
 import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
 )
 
 func TestSuggestCompressionType(t *testing.T) {
@@ -26,6 +31,14 @@ func TestSuggestCompressionType(t *testing.T) {
 			},
 			want: types.CompressionTypeBzip2,
 		},
+		{
+			name: "Parquet as None even if .gz",
+			input: &s3SelectInput{
+				FormatType: FormatTypeParquet,
+				Key:        "all-logs/2022/06/16/1626.gz",
+			},
+			want: types.CompressionTypeNone,
+		},
 		{
 			name: "JSON as None",
 			input: &s3SelectInput{
@@ -47,3 +60,177 @@ func TestSuggestCompressionType(t *testing.T) {
 		})
 	}
 }
+
+func TestToParameter(t *testing.T) {
+	input := &s3SelectInput{
+		FormatType: FormatTypeParquet,
+		Bucket:     "bucket",
+		Key:        "warehouse/dt=2022-06-16/part-00000.snappy.parquet",
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	got := input.toParameter()
+	if got.InputSerialization.Parquet == nil {
+		t.Errorf("want parquet input serialization, but got = %+v", got.InputSerialization)
+	}
+	if got.InputSerialization.JSON != nil || got.InputSerialization.CSV != nil {
+		t.Errorf("want only parquet input serialization, but got = %+v", got.InputSerialization)
+	}
+	if got.InputSerialization.CompressionType != types.CompressionTypeNone {
+		t.Errorf("want = %s, but got = %s", types.CompressionTypeNone, got.InputSerialization.CompressionType)
+	}
+}
+
+func TestRecordsQuery(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "default",
+			query: "SELECT * FROM S3Object s",
+			want:  "SELECT * FROM S3Object[*].Records[*] s",
+		},
+		{
+			name:  "lower case",
+			query: "select count(*) from s3object",
+			want:  "select count(*) FROM S3Object[*].Records[*]",
+		},
+		{
+			name:  "with path",
+			query: "SELECT * FROM S3Object[*].Records[*] s",
+			want:  "SELECT * FROM S3Object[*].Records[*] s",
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := recordsQuery(tt.query)
+			if got != tt.want {
+				t.Errorf("want = %s,\nbut got = %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     *s3SelectInput
+		size      int64
+		rangeSize int64
+		want      []*types.ScanRange
+	}{
+		{
+			name:      "json lines",
+			input:     &s3SelectInput{FormatType: FormatTypeJSON, Key: "a.json"},
+			size:      25,
+			rangeSize: 10,
+			want:      []*types.ScanRange{{Start: 0, End: 9}, {Start: 10, End: 19}, {Start: 20, End: 24}},
+		},
+		{
+			name:      "small object",
+			input:     &s3SelectInput{FormatType: FormatTypeJSON, Key: "a.json"},
+			size:      10,
+			rangeSize: 10,
+			want:      []*types.ScanRange{nil},
+		},
+		{
+			name:      "disabled",
+			input:     &s3SelectInput{FormatType: FormatTypeJSON, Key: "a.json"},
+			size:      25,
+			rangeSize: 0,
+			want:      []*types.ScanRange{nil},
+		},
+		{
+			name:      "compressed",
+			input:     &s3SelectInput{FormatType: FormatTypeALBLogs, Key: "a.log.gz"},
+			size:      25,
+			rangeSize: 10,
+			want:      []*types.ScanRange{nil},
+		},
+		{
+			name:      "csv without header",
+			input:     &s3SelectInput{FormatType: FormatTypeCSV, Key: "a.csv", CSV: &CSVOption{FieldDelimiter: "\t"}},
+			size:      20,
+			rangeSize: 10,
+			want:      []*types.ScanRange{{Start: 0, End: 9}, {Start: 10, End: 19}},
+		},
+		{
+			name:      "csv with header",
+			input:     &s3SelectInput{FormatType: FormatTypeCSV, Key: "a.csv", CSV: &CSVOption{HeaderInfo: "USE"}},
+			size:      20,
+			rangeSize: 10,
+			want:      []*types.ScanRange{nil},
+		},
+		{
+			name:      "cloudtrail document",
+			input:     &s3SelectInput{FormatType: FormatTypeCloudTrail, Key: "a.json"},
+			size:      20,
+			rangeSize: 10,
+			want:      []*types.ScanRange{nil},
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got []*types.ScanRange
+			for _, input := range tt.input.split(tt.size, tt.rangeSize) {
+				got = append(got, input.ScanRange)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want = %v,\nbut got = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// errReader returns err once at the end of r, and io.EOF after it.
+type errReader struct {
+	r    io.Reader
+	err  error
+	done bool
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF && !e.done {
+		e.done = true
+		return n, e.err
+	}
+	return n, err
+}
+
+func TestSendRecordsError(t *testing.T) {
+	errStream := errors.New("stream error")
+	cases := []struct {
+		name     string
+		body     string
+		wantRead int
+	}{
+		{name: "after records", body: `{"a":1}` + "\n" + `{"a":2}` + "\n", wantRead: 2},
+		{name: "in a record", body: `{"a":1}` + "\n" + `{"a":`, wantRead: 1},
+		{name: "no records", body: ``, wantRead: 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			in := make(chan []byte, 2)
+			r := &errReader{r: strings.NewReader(tt.body), err: errStream}
+			read, err := sendRecords(context.Background(), r, in, nil, &selectStats{}, &s3SelectInput{}, &Option{}, 0)
+			if !errors.Is(err, errStream) {
+				t.Errorf("want = %v, but got = %v", errStream, err)
+			}
+			if read != tt.wantRead {
+				t.Errorf("want = %d, but got = %d", tt.wantRead, read)
+			}
+		})
+	}
+}
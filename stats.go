@@ -0,0 +1,47 @@
+package s3s
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// selectStats is the sum of Stats events of S3 Select, or the bytes read by local engine.
+type selectStats struct {
+	requests       atomic.Int64
+	objects        atomic.Int64
+	records        atomic.Int64
+	bytesScanned   atomic.Int64
+	bytesProcessed atomic.Int64
+	bytesReturned  atomic.Int64
+
+	// done, inFlight and emitted are for Progress.
+	done     atomic.Int64
+	inFlight atomic.Int64
+	emitted  atomic.Int64
+}
+
+func (s *selectStats) add(scanned int64, processed int64, returned int64) {
+	s.bytesScanned.Add(scanned)
+	s.bytesProcessed.Add(processed)
+	s.bytesReturned.Add(returned)
+}
+
+func (s *selectStats) setResult(result *Result) {
+	result.SelectRequests = int(s.requests.Load())
+	result.Objects = int(s.objects.Load())
+	result.Records = int(s.records.Load())
+	result.BytesScanned = s.bytesScanned.Load()
+	result.BytesProcessed = s.bytesProcessed.Load()
+	result.BytesReturned = s.bytesReturned.Load()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
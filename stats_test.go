@@ -0,0 +1,120 @@
+package s3s
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRunStats(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(`{"a":3}` + "\n"))
+	w.Close()
+
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json":    []byte(`{"a":1}` + "\n" + `{"a":2}` + "\n"),
+				"prefix/b.json.gz": gz.Bytes(),
+			},
+		},
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	cases := []struct {
+		engineType    EngineType
+		prefix        string
+		wantObjects   int
+		wantScanned   int64
+		wantProcessed int64
+		wantReturned  int64
+	}{
+		{
+			// fake S3 Select can't decompress the object.
+			engineType:    EngineTypeS3Select,
+			prefix:        "s3://bucket/prefix/a",
+			wantObjects:   1,
+			wantScanned:   16,
+			wantProcessed: 16,
+			wantReturned:  16,
+		},
+		{
+			engineType:    EngineTypeLocal,
+			prefix:        "s3://bucket/prefix",
+			wantObjects:   2,
+			wantScanned:   int64(16 + gz.Len()),
+			wantProcessed: 24,
+			wantReturned:  24,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(fmt.Sprintf("engine %d", tt.engineType), func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			result, err := NewFromAPI(api).Run(context.Background(), []string{tt.prefix}, query, &Option{Output: &buf, EngineType: tt.engineType})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Objects != tt.wantObjects {
+				t.Errorf("want = %d, but got = %d", tt.wantObjects, result.Objects)
+			}
+			if result.BytesScanned != tt.wantScanned {
+				t.Errorf("want = %d, but got = %d", tt.wantScanned, result.BytesScanned)
+			}
+			if result.BytesProcessed != tt.wantProcessed {
+				t.Errorf("want = %d, but got = %d", tt.wantProcessed, result.BytesProcessed)
+			}
+			if result.BytesReturned != tt.wantReturned {
+				t.Errorf("want = %d, but got = %d", tt.wantReturned, result.BytesReturned)
+			}
+			// each record is 8 bytes with the newline.
+			if want := int(tt.wantReturned / 8); result.Records != want {
+				t.Errorf("want = %d, but got = %d", want, result.Records)
+			}
+		})
+	}
+}
+
+func TestRunStatsWithRetry(t *testing.T) {
+	api := &fakeS3{
+		objects: map[string]map[string][]byte{
+			"bucket": {
+				"prefix/a.json": []byte(`{"a":1}` + "\n"),
+			},
+		},
+		streamErr: map[string]error{
+			"prefix/a.json": &fakeAPIError{code: "InternalError"},
+		},
+		streamErrTimes: map[string]int{
+			"prefix/a.json": 1,
+		},
+	}
+	query := &Query{
+		FormatType: FormatTypeJSON,
+		Query:      "SELECT * FROM S3Object s",
+	}
+
+	var buf bytes.Buffer
+	result, err := NewFromAPI(api, WithSelectRetryDelay(1)).Run(context.Background(), []string{"s3://bucket/prefix"}, query, &Option{Output: &buf, EngineType: EngineTypeS3Select})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the failed attempt is scanned and billed, but its records are not returned twice.
+	if result.BytesScanned != 16 {
+		t.Errorf("want = %d, but got = %d", 16, result.BytesScanned)
+	}
+	if result.Records != 1 {
+		t.Errorf("want = %d, but got = %d", 1, result.Records)
+	}
+	if result.Objects != 1 {
+		t.Errorf("want = %d, but got = %d", 1, result.Objects)
+	}
+}
@@ -19,6 +19,27 @@ func isTimeZeroRange(since time.Time, until time.Time) bool {
 	return since.IsZero() && until.IsZero()
 }
 
+// isModifiedWithin keeps the object when LastModified is unknown, or the filter is disabled by a negative slack.
+func (query *Query) isModifiedWithin(lastModified *time.Time) bool {
+	if query == nil || lastModified == nil || isTimeZeroRange(query.Since, query.Until) || query.LastModifiedSlack < 0 {
+		return true
+	}
+
+	slack := query.LastModifiedSlack
+	if slack == 0 {
+		slack = DEFAULT_LAST_MODIFIED_SLACK
+	}
+	since := query.Since
+	if !since.IsZero() {
+		since = since.Add(-slack)
+	}
+	until := query.Until
+	if !until.IsZero() {
+		until = until.Add(slack)
+	}
+	return isTimeWithin(*lastModified, since, until)
+}
+
 func isTimeWithin(t time.Time, since time.Time, until time.Time) bool {
 	if !since.IsZero() && t.Before(since) {
 		return false